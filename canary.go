@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// canaryResult 最近一次金丝雀检测结果
+type canaryResult struct {
+	At  time.Time
+	Err string
+}
+
+// findRecipient 按名称查找接收者，单 OpenID 模式下名称为 legacyRecipientName
+func (p *WeChatPlugin) findRecipient(name string) (Recipient, bool) {
+	for _, r := range p.getAllRecipients() {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Recipient{}, false
+}
+
+// runCanary 周期性向金丝雀接收者发送一条低优先级消息，验证端到端推送链路
+func (p *WeChatPlugin) runCanary(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.checkCanary()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkCanary 执行一次金丝雀检测，失败时标记降级并告警，恢复后清除降级状态
+// 与其他发送一样经过 beginSend，停用时等待其完成；插件正在停用时跳过本次检测
+func (p *WeChatPlugin) checkCanary() {
+	ctx, ok := p.beginSend()
+	if !ok {
+		return
+	}
+	defer p.sends.Done()
+
+	cfg := p.configSnapshot()
+	now := time.Now()
+
+	var err error
+	r, ok := p.findRecipient(cfg.CanaryRecipient)
+	if !ok {
+		err = fmt.Errorf("canary recipient %q not found", cfg.CanaryRecipient)
+	} else {
+		_, err = p.sendToWeChat(ctx, r, OutgoingMessage{
+			Title:   "Canary Check",
+			Content: "This is a scheduled canary message from Gotify WeChat Plugin",
+			Date:    now,
+		}, nil)
+	}
+
+	if err != nil {
+		p.canary.Store(canaryResult{At: now, Err: err.Error()})
+		p.logEvent(levelWarn, "canary_failed", logFields{"error": err}, "Canary check failed: %v", err)
+		if p.degraded.CompareAndSwap(false, true) {
+			p.msgMgr.NotifyCanaryFailure(cfg.CanaryRecipient, err)
+		}
+		return
+	}
+
+	p.canary.Store(canaryResult{At: now})
+	if p.degraded.CompareAndSwap(true, false) {
+		p.logEvent(levelInfo, "canary_recovered", nil, "Canary check recovered")
+	}
+}
+
+// canaryStatus 返回最近一次金丝雀检测结果
+func (p *WeChatPlugin) canaryStatus() (canaryResult, bool) {
+	v := p.canary.Load()
+	if v == nil {
+		return canaryResult{}, false
+	}
+	return v.(canaryResult), true
+}
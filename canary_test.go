@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+// TestCanarySkippedWhileClosing 停用过程中不应再发出金丝雀消息
+func TestCanarySkippedWhileClosing(t *testing.T) {
+	mock := &mockWeChat{}
+	c := testConfig()
+	c.CanaryRecipient = legacyRecipientName
+	p := newTestPlugin(t, mock, c)
+
+	p.checkCanary()
+	if got := mock.sendCalls.Load(); got != 1 {
+		t.Fatalf("canary sends = %d, want 1", got)
+	}
+
+	p.drainSends(sendDrainTimeout)
+	p.checkCanary()
+	if got := mock.sendCalls.Load(); got != 1 {
+		t.Errorf("canary sends after drain = %d, want 1", got)
+	}
+}
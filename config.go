@@ -2,13 +2,96 @@ package main
 
 import (
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
+	"text/template"
+	"time"
+)
+
+// hexColorRegex 颜色格式 #RRGGBB
+var hexColorRegex = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// 推送后端
+const (
+	backendOfficialAccount = "official_account" // 公众号模板消息
+	backendWorkBot         = "work_bot"         // 企业微信群机器人
+)
+
+// 公众号消息接口
+const (
+	messageAPITemplate  = "template"  // 模板消息 /cgi-bin/message/template/send
+	messageAPISubscribe = "subscribe" // 订阅通知 /cgi-bin/message/subscribe/bizsend
+)
+
+// openIDRegex OpenID 格式：通常为以 o 开头的 28 位字符，此处仅检查字符集和大致长度
+var openIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+// validateOpenID 校验 OpenID 格式；以 wx 开头的多半是误填的 AppID，直接报错提示
+func validateOpenID(openid string) error {
+	if strings.HasPrefix(openid, "wx") {
+		return fmt.Errorf("openid %q looks like an AppID (starts with 'wx'), check that appid and openid are not swapped", openid)
+	}
+	if !openIDRegex.MatchString(openid) {
+		return fmt.Errorf("invalid openid %q, should be 16-64 letters, digits, '_' or '-'", openid)
+	}
+	return nil
+}
+
+// swappedIDHint AppID 不以 wx 开头但形如 OpenID（以 o 开头）时返回提示，用于追加到错误信息
+func swappedIDHint(appid string) string {
+	if strings.HasPrefix(appid, "o") && openIDRegex.MatchString(appid) {
+		return " (the value looks like an OpenID, check that appid and openid are not swapped)"
+	}
+	return ""
+}
+
+// templateIDRegex 模板 ID 格式：通常为 43 位字母、数字、下划线和连字符
+var templateIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{10,64}$`)
+
+// defaultDateLayout 默认的消息时间格式
+const defaultDateLayout = "2006-01-02 15:04:05"
+
+// defaultPingInterval 默认的消息流心跳间隔
+const defaultPingInterval = 30 * time.Second
+
+// defaultDedupWindow 默认记录的最近消息 ID 数量
+const defaultDedupWindow = 1000
+
+// defaultStreamErrorThreshold 默认连续断线多少次后发送通知
+const defaultStreamErrorThreshold = 3
+
+// 消息流消息大小上限的处理方式
+const (
+	oversizeTruncate = "truncate" // 截断到 max_message_bytes 后转发
+	oversizeDrop     = "drop"     // 丢弃整条消息
+)
+
+// defaultMaxMessageBytes 消息流消息内容的默认大小上限
+const defaultMaxMessageBytes = 64 * 1024
+
+// 模板字段默认长度上限（字符数）
+const (
+	defaultMaxTitleRunes   = 200
+	defaultMaxContentRunes = 1000
 )
 
 // Recipient 接收者配置
 type Recipient struct {
 	Name   string `yaml:"name" json:"name"`
 	OpenID string `yaml:"openid" json:"openid"`
+
+	// 该接收者使用的模板 ID，为空则使用全局 template_id
+	TemplateID string `yaml:"template_id" json:"template_id"`
+
+	// 点击消息后跳转的链接，为空则使用全局 jump_url
+	JumpURL string `yaml:"jump_url" json:"jump_url"`
+
+	// 企业微信群机器人 webhook 地址，backend 为 work_bot 时必填
+	WebhookURL string `yaml:"webhook_url" json:"webhook_url"`
+
+	// 优先级下限：低于该值的消息不会推送给此接收者（为空则不限制）
+	MinPriority *int `yaml:"min_priority" json:"min_priority"`
 }
 
 // MessageRoute 消息路由规则
@@ -16,12 +99,64 @@ type MessageRoute struct {
 	Path string `yaml:"path" json:"path"` // 如 "messages/1", "hi/123", "*"
 }
 
+// PriorityColor 优先级达到 MinPriority 时使用的字段颜色
+type PriorityColor struct {
+	MinPriority int    `yaml:"min_priority" json:"min_priority"`
+	Color       string `yaml:"color" json:"color"` // #RRGGBB
+}
+
+// Route 路由规则：满足 Match 条件的消息发送给 Recipients
+type Route struct {
+	Name       string     `yaml:"name" json:"name"`
+	Match      RouteMatch `yaml:"match" json:"match"`
+	Recipients []string   `yaml:"recipients" json:"recipients"` // 接收者名称，为空表示全部接收者
+	Account    string     `yaml:"account" json:"account"`       // 发送使用的公众号账号名称，为空表示默认账号
+	JumpURL    string     `yaml:"jump_url" json:"jump_url"`     // 命中该路由的消息的跳转链接，覆盖接收者和全局 jump_url
+}
+
+// Account 额外的公众号账号，拥有独立的凭据、模板和 access_token
+type Account struct {
+	Name       string `yaml:"name" json:"name"`
+	AppID      string `yaml:"appid" json:"appid"`
+	AppSecret  string `yaml:"app_secret" json:"app_secret"`
+	TemplateID string `yaml:"template_id" json:"template_id"`
+}
+
+// defaultAccountName 顶层 appid/app_secret/template_id 组成的默认账号名称
+const defaultAccountName = "default"
+
+// RouteMatch 路由匹配条件，所有已设置的条件需同时满足
+type RouteMatch struct {
+	AppID       *int64 `yaml:"appid" json:"appid"`               // 为空表示匹配所有应用
+	MinPriority *int   `yaml:"min_priority" json:"min_priority"` // 为空表示不限制优先级
+	// 标题需匹配的正则表达式，如 ^\[PROD\]；为空表示不限制
+	TitlePattern string `yaml:"title_pattern" json:"title_pattern"`
+	// 内容关键词：包含任意一个 message_contains 且不包含任何 message_not_contains 时匹配
+	MessageContains    []string `yaml:"message_contains" json:"message_contains"`
+	MessageNotContains []string `yaml:"message_not_contains" json:"message_not_contains"`
+	CaseSensitive      bool     `yaml:"case_sensitive" json:"case_sensitive"` // 关键词匹配区分大小写，默认不区分
+}
+
 // Config 插件配置
 type Config struct {
+	// 推送后端：official_account（公众号模板消息）或 work_bot（企业微信群机器人）
+	Backend string `yaml:"backend" json:"backend"`
+	// 群机器人使用 markdown 消息（加粗标题、彩色优先级标签），否则发送纯文本
+	WorkBotMarkdown bool `yaml:"work_bot_markdown" json:"work_bot_markdown"`
+	// 公众号后端使用的消息接口：template（模板消息）或 subscribe（订阅通知），template_id 需为对应类型的模板
+	MessageAPI string `yaml:"message_api" json:"message_api"`
+
 	AppID      string `yaml:"appid" json:"appid"`
 	AppSecret  string `yaml:"app_secret" json:"app_secret"`
 	TemplateID string `yaml:"template_id" json:"template_id"`
-	JumpURL    string `yaml:"jump_url" json:"jump_url"`
+	JumpURL    string `yaml:"jump_url" json:"jump_url"` // 为空则不设置跳转链接
+
+	// 点击消息后打开的小程序，与 jump_url 二选一
+	MiniProgramAppID    string `yaml:"miniprogram_appid" json:"miniprogram_appid"`
+	MiniProgramPagePath string `yaml:"miniprogram_pagepath" json:"miniprogram_pagepath"` // 为空则打开小程序首页
+
+	// 额外的公众号账号，路由可通过 account 指定；顶层凭据为默认账号
+	Accounts []Account `yaml:"accounts" json:"accounts"`
 
 	// 向后兼容：单 OpenID 模式
 	OpenID string `yaml:"openid" json:"openid"`
@@ -29,52 +164,371 @@ type Config struct {
 	// 多接收者模式
 	Recipients []Recipient `yaml:"recipients" json:"recipients"`
 
+	// 一条消息发给所有接收者都失败时改发的 OpenID（如值班人员），部分成功时不改发；不支持 work_bot
+	FallbackRecipients []string `yaml:"fallback_recipients" json:"fallback_recipients"`
+
 	// Gotify 连接配置（自动发现优先，手动覆盖）
 	GotifyURL   string `yaml:"gotify_url" json:"gotify_url"`     // 默认空 = 自动发现 http://localhost
 	ClientToken string `yaml:"client_token" json:"client_token"` // Gotify client token
 
+	// 通过 ?token= 查询参数而不是 X-Gotify-Key 请求头传递 client_token，用于不支持请求头认证的旧版 Gotify
+	StreamTokenInQuery bool `yaml:"stream_token_in_query" json:"stream_token_in_query"`
+
+	// 消息流心跳间隔，超过两个间隔未收到任何数据视为连接已断开；0 表示不发送心跳
+	PingInterval time.Duration `yaml:"ping_interval" json:"ping_interval"`
+
+	// 消息流 WebSocket 握手超时，避免 Gotify 无响应时连接一直挂起
+	StreamHandshakeTimeout time.Duration `yaml:"stream_handshake_timeout" json:"stream_handshake_timeout"`
+
+	// 连接 Gotify（消息流和补发消息）时跳过 TLS 证书校验，用于自签名证书的部署
+	SkipTLSVerify bool `yaml:"skip_tls_verify" json:"skip_tls_verify"`
+
+	// 记录最近转发过的消息 ID 数量，重复的消息 ID 不再转发；0 表示不去重
+	DedupWindow int `yaml:"dedup_window" json:"dedup_window"`
+
+	// 消息流断线重连的退避时间：从初始值开始每次翻倍，不超过最大值
+	ReconnectInitialBackoff time.Duration `yaml:"reconnect_initial_backoff" json:"reconnect_initial_backoff"`
+	ReconnectMaxBackoff     time.Duration `yaml:"reconnect_max_backoff" json:"reconnect_max_backoff"`
+	// 重连退避的随机抖动比例（0-1），如 0.2 表示在退避时间的 ±20% 内随机，避免多个实例同时重连；0 表示不抖动
+	ReconnectJitter float64 `yaml:"reconnect_jitter" json:"reconnect_jitter"`
+
+	// 消息流断线通知：连续失败达到阈值时通知一次，重新连接成功后重新计数
+	DisableStreamErrorNotify bool `yaml:"disable_stream_error_notify" json:"disable_stream_error_notify"`
+	StreamErrorThreshold     int  `yaml:"stream_error_threshold" json:"stream_error_threshold"`
+
 	// 消息路由规则
 	MessageRoutes []MessageRoute `yaml:"message_routes" json:"message_routes"`
+
+	// 按条件路由到指定接收者；均未命中时回退到 message_routes（命中则发送给全部接收者），
+	// 未配置 message_routes 时发送给全部接收者
+	Routes []Route `yaml:"routes" json:"routes"`
+
+	// 无条件丢弃的 Gotify 应用 ID，在路由匹配之前检查
+	ExcludedAppIDs []int64 `yaml:"excluded_app_ids" json:"excluded_app_ids"`
+
+	// 消息流消息的全局优先级下限，低于该值的消息直接丢弃，先于路由的 min_priority 生效；0 表示不限制
+	GlobalMinPriority int `yaml:"global_min_priority" json:"global_min_priority"`
+
+	// 消息时间渲染
+	DateField  string `yaml:"date_field" json:"date_field"`   // 填充消息时间的模板字段名，如 "time"；为空则不填充
+	DateLayout string `yaml:"date_layout" json:"date_layout"` // Go 时间格式，默认 "2006-01-02 15:04:05"
+	Timezone   string `yaml:"timezone" json:"timezone"`       // 如 "Asia/Shanghai"，默认为服务器本地时区
+
+	// 模板字段映射：模板字段名 -> 消息属性（title、message、priority、level、date、appid、source）或字面量
+	// 为空时使用默认的 title/content 字段
+	TemplateFieldMap map[string]string `yaml:"template_field_map" json:"template_field_map"`
+
+	// 消息 extras 中携带模板字段值的键，其值为「模板字段名 -> 字符串值」，覆盖默认字段；为空则不读取
+	ExtrasFieldsKey string `yaml:"extras_fields_key" json:"extras_fields_key"`
+
+	// 字段颜色（#RRGGBB），为空则使用模板默认颜色
+	FieldColor     string          `yaml:"field_color" json:"field_color"`
+	PriorityColors []PriorityColor `yaml:"priority_colors" json:"priority_colors"` // 按优先级覆盖 field_color
+	TopColor       string          `yaml:"top_color" json:"top_color"`             // 模板消息顶部颜色（topcolor），仅部分客户端版本生效
+
+	// 来源与级别字段
+	AppNames      map[int64]string `yaml:"app_names" json:"app_names"`             // Gotify appid -> 应用名称
+	SourceField   string           `yaml:"source_field" json:"source_field"`       // 填充来源应用名称的模板字段名
+	LevelField    string           `yaml:"level_field" json:"level_field"`         // 填充优先级标签的模板字段名
+	PrefixAppName bool             `yaml:"prefix_app_name" json:"prefix_app_name"` // 在消息流转发的内容前加上来源应用名称
+
+	// 关闭推送成功和启用/停用状态的 Gotify 通知（错误通知不受影响）
+	DisableSelfNotify bool `yaml:"disable_self_notify" json:"disable_self_notify"`
+
+	// 插件发出的 Gotify 通知的优先级（0-10）：推送成功、错误类告警（推送失败、暂停、自检失败、配额预警）、启用/停用状态变更
+	DeliveryNotifyPriority int `yaml:"delivery_notify_priority" json:"delivery_notify_priority"`
+	ErrorNotifyPriority    int `yaml:"error_notify_priority" json:"error_notify_priority"`
+	StatusNotifyPriority   int `yaml:"status_notify_priority" json:"status_notify_priority"`
+
+	// 启用/停用状态变更、推送成功、推送失败通知的标题和正文模板（text/template），为空时使用默认文案
+	StatusNotifyTitle     string `yaml:"status_notify_title" json:"status_notify_title"`
+	StatusNotifyMessage   string `yaml:"status_notify_message" json:"status_notify_message"`
+	DeliveryNotifyTitle   string `yaml:"delivery_notify_title" json:"delivery_notify_title"`
+	DeliveryNotifyMessage string `yaml:"delivery_notify_message" json:"delivery_notify_message"`
+	ErrorNotifyTitle      string `yaml:"error_notify_title" json:"error_notify_title"`
+	ErrorNotifyMessage    string `yaml:"error_notify_message" json:"error_notify_message"`
+
+	// 插件生成文本（Gotify 通知的默认文案、状态页）的语言：zh 或 en
+	Language string `yaml:"language" json:"language"`
+
+	// Webhook 密钥，请求需携带匹配的 X-Webhook-Secret 头；/debug 必须配置
+	WebhookSecret string `yaml:"webhook_secret" json:"webhook_secret"`
+
+	// 是否开放 POST /send 和 GET /test 端点，关闭后请求返回 404
+	EnableSendEndpoint bool `yaml:"enable_send_endpoint" json:"enable_send_endpoint"`
+	EnableTestEndpoint bool `yaml:"enable_test_endpoint" json:"enable_test_endpoint"`
+
+	// Unicode 规范化：NFC 组合，可选去除组合附加符号
+	NormalizeUnicode    bool `yaml:"normalize_unicode" json:"normalize_unicode"`
+	StripCombiningMarks bool `yaml:"strip_combining_marks" json:"strip_combining_marks"`
+
+	// 调用微信和 Gotify HTTP 接口的超时时间
+	HTTPTimeout time.Duration `yaml:"http_timeout" json:"http_timeout"`
+
+	// 调用微信接口使用的代理（http、https、socks5），为空时使用 HTTP_PROXY/HTTPS_PROXY 环境变量
+	ProxyURL string `yaml:"proxy_url" json:"proxy_url"`
+
+	// 调用微信接口时跳过 TLS 证书校验，仅用于调试（如经过抓包代理）
+	WeChatSkipTLSVerify bool `yaml:"wechat_skip_tls_verify" json:"wechat_skip_tls_verify"`
+
+	// 调用微信接口时的 User-Agent，为空时使用 gotify-wechat-plugin/<版本号>
+	UserAgent string `yaml:"user_agent" json:"user_agent"`
+
+	// access_token 提前刷新的时间：距过期不足该时长时视为失效并重新获取
+	TokenRefreshMargin time.Duration `yaml:"token_refresh_margin" json:"token_refresh_margin"`
+
+	// 重试策略：网络错误和可重试的微信错误码按指数退避重试
+	MaxRetries   int           `yaml:"max_retries" json:"max_retries"`     // 每个接收者的最大重试次数，0 表示不重试
+	RetryBackoff time.Duration `yaml:"retry_backoff" json:"retry_backoff"` // 首次重试等待时间，之后每次翻倍
+
+	// 单条消息在所有接收者之间共享的重试次数上限，0 表示使用默认值（接收者数 × 2）
+	FanoutRetryBudget int `yaml:"fanout_retry_budget" json:"fanout_retry_budget"`
+
+	// 发送限流：超出限制的发送排队等待，避免触发微信频率限制
+	MaxConcurrency  int           `yaml:"max_concurrency" json:"max_concurrency"`     // 同时进行的微信 API 调用数上限，0 表示不限制
+	MinSendInterval time.Duration `yaml:"min_send_interval" json:"min_send_interval"` // 相邻两次调用的最小间隔，0 表示不限制
+
+	// 每日模板消息配额（按 timezone 的自然日计算），0 表示不限制
+	DailyQuotaWarn int64 `yaml:"daily_quota_warn" json:"daily_quota_warn"` // 达到后发送一次预警
+	DailyQuotaHard int64 `yaml:"daily_quota_hard" json:"daily_quota_hard"` // 达到后停止发送
+
+	// 金丝雀检测：定期向指定接收者发送一条真实消息，验证端到端推送
+	CanaryInterval  time.Duration `yaml:"canary_interval" json:"canary_interval"`   // 0 表示不启用
+	CanaryRecipient string        `yaml:"canary_recipient" json:"canary_recipient"` // 接收者名称，单 OpenID 模式为 "default"
+
+	// 启用后最多转发的消息流消息数，超过后自动暂停直到调用 /resume；0 表示不限制
+	ForwardLimit int64 `yaml:"forward_limit" json:"forward_limit"`
+
+	// 消息流转发时内容的 text/template 模板，可引用 .Title .Message .Priority .AppID .Date .Extras；为空则使用原始内容
+	MessageTemplate string `yaml:"message_template" json:"message_template"`
+
+	// 将声明为 markdown（extras client::display.contentType）的消息内容转换为纯文本
+	FlattenMarkdown bool `yaml:"flatten_markdown" json:"flatten_markdown"`
+	// 忽略消息声明的内容类型，所有消息按纯文本原样转发（不执行 flatten_markdown）
+	ForcePlainText bool `yaml:"force_plain_text" json:"force_plain_text"`
+
+	// 合并推送：窗口内发送给同一组接收者的消息合并为一条，达到 DigestMaxCount 条时立即发送
+	DigestWindow   time.Duration `yaml:"digest_window" json:"digest_window"`       // 0 表示不合并
+	DigestMaxCount int           `yaml:"digest_max_count" json:"digest_max_count"` // 0 表示不限制
+
+	// 免打扰时段（HH:MM，按 timezone 计算，可跨越午夜）：期间低于 QuietMinPriority 的消息流消息不转发
+	QuietStart       string `yaml:"quiet_start" json:"quiet_start"`
+	QuietEnd         string `yaml:"quiet_end" json:"quiet_end"`
+	QuietMinPriority int    `yaml:"quiet_min_priority" json:"quiet_min_priority"`
+
+	// 在内容末尾追加消息优先级和时间
+	IncludePriority  bool `yaml:"include_priority" json:"include_priority"`
+	IncludeTimestamp bool `yaml:"include_timestamp" json:"include_timestamp"`
+
+	// 所有推送内容统一添加的前缀（如 "【Gotify】"）和末尾的附加文本，计入 max_content_runes
+	ContentPrefix string `yaml:"content_prefix" json:"content_prefix"`
+	ContentSuffix string `yaml:"content_suffix" json:"content_suffix"`
+
+	// 模板字段长度上限（按字符计算），超出时截断并追加省略号，0 表示不截断
+	MaxTitleRunes   int `yaml:"max_title_runes" json:"max_title_runes"`
+	MaxContentRunes int `yaml:"max_content_runes" json:"max_content_runes"`
+
+	// 消息流消息内容的大小上限（UTF-8 字节），超出时按 oversize_action 截断（truncate）或丢弃（drop）；0 表示不限制
+	MaxMessageBytes int    `yaml:"max_message_bytes" json:"max_message_bytes"`
+	OversizeAction  string `yaml:"oversize_action" json:"oversize_action"`
+
+	// 保留的最近投递记录数，通过 /history 查看；0 表示不记录
+	HistorySize int `yaml:"history_size" json:"history_size"`
+
+	// 保存在插件存储中的发送失败消息（死信）上限，通过 /deadletter 查看和重发；0 表示不保存
+	DeadLetterSize int `yaml:"dead_letter_size" json:"dead_letter_size"`
+
+	// 统计持久化间隔，0 表示仅在停用时写入
+	StatsFlushInterval time.Duration `yaml:"stats_flush_interval" json:"stats_flush_interval"`
+
+	// 以 JSON 行格式输出日志，便于日志采集系统解析；默认输出人类可读文本
+	JSONLogs bool `yaml:"json_logs" json:"json_logs"`
+
+	location        *time.Location     // 由 Timezone 解析得到
+	quietEnabled    bool               // 是否配置了免打扰时段
+	quietStart      int                // 免打扰开始时间（当日分钟数）
+	quietEnd        int                // 免打扰结束时间（当日分钟数）
+	messageTemplate *template.Template // 由 MessageTemplate 解析得到
+	notifyTemplates notifyTemplates    // 由 *_notify_title、*_notify_message 解析得到
+	router          *MessageRouter     // 由 Routes 和 MessageRoutes 构建，消息流与 /send 共用
 }
 
 func (p *WeChatPlugin) DefaultConfig() interface{} {
 	return &Config{
-		AppID:         "",
-		AppSecret:     "",
-		OpenID:        "",
-		TemplateID:    "",
-		JumpURL:       "https://127.0.0.1",
-		Recipients:    []Recipient{},
-		GotifyURL:     "",
-		ClientToken:   "",
-		MessageRoutes: []MessageRoute{},
+		Backend:             backendOfficialAccount,
+		WorkBotMarkdown:     false,
+		MessageAPI:          messageAPITemplate,
+		AppID:               "",
+		AppSecret:           "",
+		OpenID:              "",
+		TemplateID:          "",
+		JumpURL:             "",
+		MiniProgramAppID:    "",
+		MiniProgramPagePath: "",
+		Recipients:          []Recipient{},
+		FallbackRecipients:  []string{},
+		Accounts:            []Account{},
+		GotifyURL:           "", // 为空时自动使用 http://localhost
+		ClientToken:         "", // 为空时不启动消息流监听
+		MessageRoutes:       []MessageRoute{},
+		Routes:              []Route{},
+		ExcludedAppIDs:      []int64{},
+		GlobalMinPriority:   0,
+		DateField:           "",
+		DateLayout:          defaultDateLayout,
+		Timezone:            "",
+		TemplateFieldMap:    map[string]string{},
+		ExtrasFieldsKey:     defaultExtrasFieldsKey,
+		FieldColor:          "",
+		TopColor:            "",
+		PriorityColors:      []PriorityColor{},
+		AppNames:            map[int64]string{},
+		SourceField:         "",
+		PrefixAppName:       false,
+		LevelField:          "",
+		ForwardLimit:        0,
+		MessageTemplate:     "",
+		FlattenMarkdown:     false,
+		ForcePlainText:      false,
+		DigestWindow:        0,
+		DigestMaxCount:      defaultDigestMaxCount,
+		QuietStart:          "",
+		QuietEnd:            "",
+		QuietMinPriority:    defaultQuietMinPriority,
+		IncludePriority:     false,
+		IncludeTimestamp:    false,
+		ContentPrefix:       "",
+		ContentSuffix:       "",
+		MaxTitleRunes:       defaultMaxTitleRunes,
+		MaxContentRunes:     defaultMaxContentRunes,
+		MaxMessageBytes:     defaultMaxMessageBytes,
+		OversizeAction:      oversizeTruncate,
+
+		PingInterval: defaultPingInterval,
+		DedupWindow:  defaultDedupWindow,
+
+		StreamTokenInQuery:     false,
+		StreamHandshakeTimeout: 10 * time.Second,
+		SkipTLSVerify:          false,
+
+		ReconnectInitialBackoff: time.Second,
+		ReconnectMaxBackoff:     2 * time.Minute,
+		ReconnectJitter:         0.2,
+
+		DisableStreamErrorNotify: false,
+		StreamErrorThreshold:     defaultStreamErrorThreshold,
+
+		HTTPTimeout: 10 * time.Second,
+		ProxyURL:    "",
+		UserAgent:   "",
+
+		WeChatSkipTLSVerify: false,
+
+		TokenRefreshMargin: 5 * time.Minute,
+
+		MaxRetries:        2,
+		RetryBackoff:      time.Second,
+		FanoutRetryBudget: 0,
+
+		MaxConcurrency:  0,
+		MinSendInterval: 0,
+
+		DailyQuotaWarn: 0,
+		DailyQuotaHard: 0,
+
+		CanaryInterval:  0,
+		CanaryRecipient: "",
+		WebhookSecret:   "",
+
+		EnableSendEndpoint: true,
+		EnableTestEndpoint: true,
+
+		DisableSelfNotify: false,
+
+		DeliveryNotifyPriority: defaultDeliveryNotifyPriority,
+		ErrorNotifyPriority:    defaultErrorNotifyPriority,
+		StatusNotifyPriority:   defaultStatusNotifyPriority,
+
+		StatusNotifyTitle:     "",
+		StatusNotifyMessage:   "",
+		DeliveryNotifyTitle:   "",
+		DeliveryNotifyMessage: "",
+		ErrorNotifyTitle:      "",
+		ErrorNotifyMessage:    "",
+
+		Language: defaultLanguage,
+
+		NormalizeUnicode:    false,
+		StripCombiningMarks: false,
+
+		HistorySize:        defaultHistorySize,
+		DeadLetterSize:     defaultDeadLetterSize,
+		StatsFlushInterval: time.Minute,
+		JSONLogs:           false,
 	}
 }
 
 func (p *WeChatPlugin) ValidateAndSetConfig(c interface{}) error {
 	config := c.(*Config)
 
-	if strings.TrimSpace(config.AppID) == "" {
-		return fmt.Errorf("AppID is required")
+	config.Backend = strings.TrimSpace(config.Backend)
+	if config.Backend == "" {
+		config.Backend = backendOfficialAccount
+	}
+	workBot := config.Backend == backendWorkBot
+
+	config.MessageAPI = strings.TrimSpace(config.MessageAPI)
+	if config.MessageAPI == "" {
+		config.MessageAPI = messageAPITemplate
 	}
-	if strings.TrimSpace(config.AppSecret) == "" {
-		return fmt.Errorf("AppSecret is required")
+	if config.MessageAPI != messageAPITemplate && config.MessageAPI != messageAPISubscribe {
+		return fmt.Errorf("invalid message_api %q, should be %q or %q", config.MessageAPI, messageAPITemplate, messageAPISubscribe)
 	}
-	if strings.TrimSpace(config.TemplateID) == "" {
-		return fmt.Errorf("TemplateID is required")
+	if workBot && config.MessageAPI != messageAPITemplate {
+		return fmt.Errorf("message_api is not supported by the work_bot backend")
 	}
 
-	if !strings.HasPrefix(config.AppID, "wx") {
-		return fmt.Errorf("invalid AppID format, should start with 'wx'")
+	switch config.Backend {
+	case backendOfficialAccount:
+		if strings.TrimSpace(config.AppID) == "" {
+			return fmt.Errorf("AppID is required")
+		}
+		if strings.TrimSpace(config.AppSecret) == "" {
+			return fmt.Errorf("AppSecret is required")
+		}
+		if strings.TrimSpace(config.TemplateID) == "" {
+			return fmt.Errorf("TemplateID is required")
+		}
+
+		if !strings.HasPrefix(config.AppID, "wx") {
+			return fmt.Errorf("invalid AppID format, should start with 'wx'%s", swappedIDHint(config.AppID))
+		}
+		config.TemplateID = strings.TrimSpace(config.TemplateID)
+		if !templateIDRegex.MatchString(config.TemplateID) {
+			return fmt.Errorf("invalid template_id %q, should be the 10-64 character ID (letters, digits, '_' or '-') shown in the WeChat template library", config.TemplateID)
+		}
+	case backendWorkBot:
+		// 群机器人只需要 webhook 地址，不使用 AppID 和模板
+	default:
+		return fmt.Errorf("invalid backend %q, should be %q or %q", config.Backend, backendOfficialAccount, backendWorkBot)
 	}
 
 	// 至少需要配置一个 OpenID（单模式）或一个 Recipient（多模式）
-	hasLegacyOpenID := strings.TrimSpace(config.OpenID) != ""
+	config.OpenID = strings.TrimSpace(config.OpenID)
+	hasLegacyOpenID := strings.TrimSpace(config.OpenID) != "" && !workBot
 	hasRecipients := len(config.Recipients) > 0
 
+	if workBot && !hasRecipients {
+		return fmt.Errorf("at least one Recipient with webhook_url is required when backend is %q", backendWorkBot)
+	}
 	if !hasLegacyOpenID && !hasRecipients {
 		return fmt.Errorf("at least one OpenID or Recipient is required")
 	}
+	if hasLegacyOpenID {
+		if err := validateOpenID(config.OpenID); err != nil {
+			return err
+		}
+	}
 
 	// 验证 Recipients
 	recipientNames := make(map[string]bool)
@@ -82,17 +536,54 @@ func (p *WeChatPlugin) ValidateAndSetConfig(c interface{}) error {
 		if strings.TrimSpace(r.Name) == "" {
 			return fmt.Errorf("recipient[%d]: name is required", i)
 		}
-		if strings.TrimSpace(r.OpenID) == "" {
+		if workBot {
+			if err := validateWebhookURL(r.WebhookURL); err != nil {
+				return fmt.Errorf("recipient[%d] %q: %w", i, r.Name, err)
+			}
+		} else if strings.TrimSpace(r.OpenID) == "" {
 			return fmt.Errorf("recipient[%d] %q: openid is required", i, r.Name)
+		} else if err := validateOpenID(r.OpenID); err != nil {
+			return fmt.Errorf("recipient[%d] %q: %w", i, r.Name, err)
 		}
 		if recipientNames[r.Name] {
 			return fmt.Errorf("recipient[%d]: duplicate name %q", i, r.Name)
 		}
+		config.Recipients[i].JumpURL = strings.TrimSpace(r.JumpURL)
+		if err := validateJumpURL(config.Recipients[i].JumpURL); err != nil {
+			return fmt.Errorf("recipient[%d] %q: %w", i, r.Name, err)
+		}
+		if r.TemplateID != "" && !templateIDRegex.MatchString(r.TemplateID) {
+			return fmt.Errorf("recipient[%d] %q: invalid template_id %q, should be 10-64 letters, digits, '_' or '-'", i, r.Name, r.TemplateID)
+		}
+		if r.MinPriority != nil && *r.MinPriority < 0 {
+			return fmt.Errorf("recipient[%d] %q: min_priority must not be negative", i, r.Name)
+		}
 		recipientNames[r.Name] = true
 	}
 
-	if strings.TrimSpace(config.JumpURL) == "" {
-		config.JumpURL = "https://127.0.0.1"
+	config.JumpURL = strings.TrimSpace(config.JumpURL)
+	if err := validateJumpURL(config.JumpURL); err != nil {
+		return err
+	}
+
+	// 小程序跳转与链接跳转只能启用一种
+	config.MiniProgramAppID = strings.TrimSpace(config.MiniProgramAppID)
+	config.MiniProgramPagePath = strings.TrimSpace(config.MiniProgramPagePath)
+	if config.MiniProgramPagePath != "" && config.MiniProgramAppID == "" {
+		return fmt.Errorf("miniprogram_appid is required when miniprogram_pagepath is set")
+	}
+	if config.MiniProgramAppID != "" {
+		if !strings.HasPrefix(config.MiniProgramAppID, "wx") {
+			return fmt.Errorf("invalid miniprogram_appid format, should start with 'wx'")
+		}
+		if config.JumpURL != "" {
+			return fmt.Errorf("jump_url and miniprogram_appid cannot both be set, choose one redirect mode")
+		}
+		for i, r := range config.Recipients {
+			if r.JumpURL != "" {
+				return fmt.Errorf("recipient[%d] %q: jump_url cannot be set when miniprogram_appid is configured", i, r.Name)
+			}
+		}
 	}
 
 	// 验证消息路由规则
@@ -102,14 +593,648 @@ func (p *WeChatPlugin) ValidateAndSetConfig(c interface{}) error {
 		}
 	}
 
+	// 验证备用接收者
+	if workBot && len(config.FallbackRecipients) > 0 {
+		return fmt.Errorf("fallback_recipients are not supported when backend is %q", backendWorkBot)
+	}
+	if len(config.FallbackRecipients) > 0 && recipientNames[fallbackRecipientName] {
+		return fmt.Errorf("recipient name %q is reserved when fallback_recipients is set", fallbackRecipientName)
+	}
+	for i, openid := range config.FallbackRecipients {
+		openid = strings.TrimSpace(openid)
+		if err := validateOpenID(openid); err != nil {
+			return fmt.Errorf("fallback_recipients[%d]: %w", i, err)
+		}
+		config.FallbackRecipients[i] = openid
+	}
+
+	// 验证额外的公众号账号
+	accountNames := map[string]bool{defaultAccountName: true}
+	if workBot && len(config.Accounts) > 0 {
+		return fmt.Errorf("accounts are not supported when backend is %q", backendWorkBot)
+	}
+	for i, a := range config.Accounts {
+		name := strings.TrimSpace(a.Name)
+		if name == "" {
+			return fmt.Errorf("accounts[%d]: name is required", i)
+		}
+		if accountNames[name] {
+			return fmt.Errorf("accounts[%d]: duplicate or reserved name %q", i, name)
+		}
+		if !strings.HasPrefix(strings.TrimSpace(a.AppID), "wx") {
+			return fmt.Errorf("accounts[%d] %q: invalid appid format, should start with 'wx'%s", i, name, swappedIDHint(strings.TrimSpace(a.AppID)))
+		}
+		if strings.TrimSpace(a.AppSecret) == "" {
+			return fmt.Errorf("accounts[%d] %q: app_secret is required", i, name)
+		}
+		if !templateIDRegex.MatchString(strings.TrimSpace(a.TemplateID)) {
+			return fmt.Errorf("accounts[%d] %q: invalid template_id %q, should be 10-64 letters, digits, '_' or '-'", i, name, a.TemplateID)
+		}
+		config.Accounts[i] = Account{
+			Name:       name,
+			AppID:      strings.TrimSpace(a.AppID),
+			AppSecret:  strings.TrimSpace(a.AppSecret),
+			TemplateID: strings.TrimSpace(a.TemplateID),
+		}
+		accountNames[name] = true
+	}
+
+	// 验证路由，引用的接收者和账号必须存在
+	for i, route := range config.Routes {
+		if route.Account != "" && !accountNames[route.Account] {
+			return fmt.Errorf("routes[%d] %q: unknown account %q", i, route.Name, route.Account)
+		}
+		config.Routes[i].JumpURL = strings.TrimSpace(route.JumpURL)
+		if err := validateJumpURL(config.Routes[i].JumpURL); err != nil {
+			return fmt.Errorf("routes[%d] %q: %w", i, route.Name, err)
+		}
+		if config.Routes[i].JumpURL != "" && config.MiniProgramAppID != "" {
+			return fmt.Errorf("routes[%d] %q: jump_url cannot be set when miniprogram_appid is configured", i, route.Name)
+		}
+		if route.Match.MinPriority != nil && *route.Match.MinPriority < 0 {
+			return fmt.Errorf("routes[%d] %q: min_priority must not be negative", i, route.Name)
+		}
+		if route.Match.TitlePattern != "" {
+			if _, err := regexp.Compile(route.Match.TitlePattern); err != nil {
+				return fmt.Errorf("routes[%d] %q: invalid title_pattern %q: %v", i, route.Name, route.Match.TitlePattern, err)
+			}
+		}
+		for _, kw := range route.Match.MessageContains {
+			if kw == "" {
+				return fmt.Errorf("routes[%d] %q: message_contains must not contain empty keywords (matches when the message contains any keyword)", i, route.Name)
+			}
+		}
+		for _, kw := range route.Match.MessageNotContains {
+			if kw == "" {
+				return fmt.Errorf("routes[%d] %q: message_not_contains must not contain empty keywords (rejects the message if it contains any keyword)", i, route.Name)
+			}
+		}
+		if len(route.Recipients) > 0 && len(config.Recipients) == 0 {
+			return fmt.Errorf("routes[%d] %q: routes referencing recipients require the recipients list, but no recipients are configured (single openid mode); move openid into recipients and reference it by name", i, route.Name)
+		}
+		for _, name := range route.Recipients {
+			if !recipientNames[name] {
+				return fmt.Errorf("routes[%d] %q: unknown recipient %q", i, route.Name, name)
+			}
+		}
+	}
+
+	if len(config.Routes) > 0 && len(config.Recipients) == 0 {
+		p.logEvent(levelWarn, "config_warning", nil, "routes are defined but recipients is empty; in single openid mode matching routes can only deliver to the openid")
+	}
+
+	if config.GlobalMinPriority < 0 {
+		return fmt.Errorf("global_min_priority must not be negative")
+	}
+	for i, id := range config.ExcludedAppIDs {
+		if id <= 0 {
+			return fmt.Errorf("excluded_app_ids[%d]: invalid app id %d, must be positive", i, id)
+		}
+	}
+
 	// 如果配置了消息路由，则 ClientToken 必填
-	if len(config.MessageRoutes) > 0 && strings.TrimSpace(config.ClientToken) == "" {
-		return fmt.Errorf("client_token is required when message_routes are configured")
+	if (len(config.MessageRoutes) > 0 || len(config.Routes) > 0) && strings.TrimSpace(config.ClientToken) == "" {
+		return fmt.Errorf("client_token is required when message_routes or routes are configured")
+	}
+
+	// 验证 Gotify 地址
+	config.GotifyURL = strings.TrimSpace(config.GotifyURL)
+	if config.GotifyURL != "" {
+		u, err := normalizeGotifyURL(config.GotifyURL)
+		if err != nil {
+			return err
+		}
+		config.GotifyURL = u.String()
+	} else if strings.TrimSpace(config.ClientToken) != "" {
+		p.logEvent(levelWarn, "config_warning", nil, "client_token is set but gotify_url is empty, falling back to http://localhost")
+	}
+
+	if config.PingInterval < 0 {
+		return fmt.Errorf("ping_interval must not be negative")
+	}
+	if config.StreamHandshakeTimeout <= 0 {
+		return fmt.Errorf("stream_handshake_timeout must be positive")
+	}
+	if config.SkipTLSVerify {
+		p.logEvent(levelWarn, "config_warning", nil, "skip_tls_verify is enabled, TLS certificates of the Gotify server are not verified")
+	}
+	if config.DedupWindow < 0 {
+		return fmt.Errorf("dedup_window must not be negative")
+	}
+	if config.ReconnectInitialBackoff <= 0 || config.ReconnectMaxBackoff <= 0 {
+		return fmt.Errorf("reconnect_initial_backoff and reconnect_max_backoff must be positive")
+	}
+	if config.ReconnectJitter < 0 || config.ReconnectJitter >= 1 {
+		return fmt.Errorf("reconnect_jitter must be at least 0 and less than 1, got %v", config.ReconnectJitter)
+	}
+	if config.StreamErrorThreshold < 1 {
+		return fmt.Errorf("stream_error_threshold must be at least 1")
+	}
+	if config.ReconnectInitialBackoff > config.ReconnectMaxBackoff {
+		return fmt.Errorf("reconnect_initial_backoff (%v) must not exceed reconnect_max_backoff (%v)",
+			config.ReconnectInitialBackoff, config.ReconnectMaxBackoff)
+	}
+
+	// 验证模板字段映射
+	for field, source := range config.TemplateFieldMap {
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("template_field_map: field name is required")
+		}
+		if strings.TrimSpace(source) == "" {
+			return fmt.Errorf("template_field_map[%q]: value is required", field)
+		}
+	}
+
+	config.ExtrasFieldsKey = strings.TrimSpace(config.ExtrasFieldsKey)
+
+	// 验证字段颜色
+	if config.FieldColor != "" && !hexColorRegex.MatchString(config.FieldColor) {
+		return fmt.Errorf("invalid field_color %q, expected #RRGGBB", config.FieldColor)
+	}
+	config.TopColor = strings.TrimSpace(config.TopColor)
+	if config.TopColor != "" && !hexColorRegex.MatchString(config.TopColor) {
+		return fmt.Errorf("invalid top_color %q, expected #RRGGBB", config.TopColor)
+	}
+	for i, pc := range config.PriorityColors {
+		if !hexColorRegex.MatchString(pc.Color) {
+			return fmt.Errorf("priority_colors[%d]: invalid color %q, expected #RRGGBB", i, pc.Color)
+		}
+	}
+
+	// 验证时间格式与时区
+	if strings.TrimSpace(config.DateLayout) == "" {
+		config.DateLayout = defaultDateLayout
+	}
+	if err := validateDateLayout(config.DateLayout); err != nil {
+		return err
+	}
+	tmpl, err := parseMessageTemplate(config.MessageTemplate)
+	if err != nil {
+		return err
+	}
+	config.messageTemplate = tmpl
+	config.router = NewMessageRouter(config.Routes, legacyRoutes(config.MessageRoutes))
+
+	config.quietEnabled = config.QuietStart != "" || config.QuietEnd != ""
+	if config.quietEnabled {
+		start, err := parseClock(config.QuietStart)
+		if err != nil {
+			return fmt.Errorf("invalid quiet_start: %w", err)
+		}
+		end, err := parseClock(config.QuietEnd)
+		if err != nil {
+			return fmt.Errorf("invalid quiet_end: %w", err)
+		}
+		if start == end {
+			return fmt.Errorf("quiet_start and quiet_end must differ")
+		}
+		config.quietStart, config.quietEnd = start, end
+	}
+	if config.QuietMinPriority < 0 {
+		return fmt.Errorf("quiet_min_priority must not be negative")
+	}
+
+	if config.DigestWindow < 0 || config.DigestMaxCount < 0 {
+		return fmt.Errorf("digest_window and digest_max_count must not be negative")
+	}
+
+	if config.HistorySize < 0 {
+		return fmt.Errorf("history_size must not be negative")
+	}
+	if config.DeadLetterSize < 0 {
+		return fmt.Errorf("dead_letter_size must not be negative")
+	}
+	if config.HTTPTimeout <= 0 {
+		return fmt.Errorf("http_timeout must be positive")
+	}
+	config.ProxyURL = strings.TrimSpace(config.ProxyURL)
+	proxy, err := parseProxyURL(config.ProxyURL)
+	if err != nil {
+		return err
+	}
+	if config.WeChatSkipTLSVerify {
+		p.logEvent(levelWarn, "config_warning", nil, "wechat_skip_tls_verify is enabled, TLS certificates of the WeChat API are not verified")
+	}
+	if config.TokenRefreshMargin < 0 || config.TokenRefreshMargin >= wechatTokenLifetime {
+		return fmt.Errorf("token_refresh_margin must be between 0 and %v (access_token lifetime)", wechatTokenLifetime)
+	}
+	config.UserAgent = strings.TrimSpace(config.UserAgent)
+	if strings.ContainsAny(config.UserAgent, "\r\n") {
+		return fmt.Errorf("user_agent must not contain line breaks")
+	}
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if config.MaxRetries > 0 && config.RetryBackoff <= 0 {
+		return fmt.Errorf("retry_backoff must be positive when max_retries is set")
+	}
+
+	if config.FanoutRetryBudget < 0 {
+		return fmt.Errorf("fanout_retry_budget must not be negative")
+	}
+
+	if config.MaxTitleRunes < 0 || config.MaxContentRunes < 0 {
+		return fmt.Errorf("max_title_runes and max_content_runes must not be negative")
+	}
+	if config.MaxMessageBytes < 0 {
+		return fmt.Errorf("max_message_bytes must not be negative")
+	}
+	config.OversizeAction = strings.TrimSpace(config.OversizeAction)
+	if config.OversizeAction == "" {
+		config.OversizeAction = oversizeTruncate
+	}
+	if config.OversizeAction != oversizeTruncate && config.OversizeAction != oversizeDrop {
+		return fmt.Errorf("invalid oversize_action %q, should be %q or %q", config.OversizeAction, oversizeTruncate, oversizeDrop)
+	}
+
+	if config.MaxConcurrency < 0 {
+		return fmt.Errorf("max_concurrency must not be negative")
+	}
+	if config.MinSendInterval < 0 {
+		return fmt.Errorf("min_send_interval must not be negative")
+	}
+
+	if config.DailyQuotaWarn < 0 || config.DailyQuotaHard < 0 {
+		return fmt.Errorf("daily_quota_warn and daily_quota_hard must not be negative")
+	}
+	if config.DailyQuotaWarn > 0 && config.DailyQuotaHard > 0 && config.DailyQuotaWarn > config.DailyQuotaHard {
+		return fmt.Errorf("daily_quota_warn (%d) must not exceed daily_quota_hard (%d)", config.DailyQuotaWarn, config.DailyQuotaHard)
+	}
+
+	if config.CanaryInterval < 0 {
+		return fmt.Errorf("canary_interval must not be negative")
+	}
+	if config.CanaryInterval > 0 {
+		name := strings.TrimSpace(config.CanaryRecipient)
+		if name == "" {
+			return fmt.Errorf("canary_recipient is required when canary_interval is set")
+		}
+		found := name == legacyRecipientName && len(config.Recipients) == 0 && hasLegacyOpenID
+		for _, r := range config.Recipients {
+			if r.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("canary_recipient %q does not match any recipient", name)
+		}
+	}
+
+	for _, np := range []struct {
+		key   string
+		value int
+	}{
+		{"delivery_notify_priority", config.DeliveryNotifyPriority},
+		{"error_notify_priority", config.ErrorNotifyPriority},
+		{"status_notify_priority", config.StatusNotifyPriority},
+	} {
+		if np.value < 0 || np.value > 10 {
+			return fmt.Errorf("%s must be between 0 and 10, got %d", np.key, np.value)
+		}
+	}
+	config.Language = strings.ToLower(strings.TrimSpace(config.Language))
+	if config.Language == "" {
+		config.Language = defaultLanguage
+	}
+	if _, ok := messageCatalogs[config.Language]; !ok {
+		return fmt.Errorf("invalid language %q, should be %q or %q", config.Language, languageZH, languageEN)
+	}
+	templates, err := config.compileNotifyTemplates()
+	if err != nil {
+		return err
+	}
+	config.notifyTemplates = templates
+
+	if config.ForwardLimit < 0 {
+		return fmt.Errorf("forward_limit must not be negative")
+	}
+
+	if config.StatsFlushInterval < 0 {
+		return fmt.Errorf("stats_flush_interval must not be negative")
+	}
+
+	config.location = time.Local
+	if tz := strings.TrimSpace(config.Timezone); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", tz, err)
+		}
+		config.location = loc
+	}
+
+	// 前缀、后缀和优先级/时间行依赖 language、date_layout 和 timezone，最后再检查
+	if n := config.reservedContentRunes(); config.MaxContentRunes > 0 && n >= config.MaxContentRunes {
+		return fmt.Errorf("content_prefix, content_suffix and the include_priority/include_timestamp lines (up to %d characters) must be shorter than max_content_runes (%d)", n, config.MaxContentRunes)
 	}
 
 	p.mu.Lock()
+	p.configMu.Lock()
 	p.config = config
+	p.configMu.Unlock()
+	if old := p.httpClient.Swap(newWeChatHTTPClient(config.HTTPTimeout, proxy, config.WeChatSkipTLSVerify)); old != nil {
+		old.CloseIdleConnections()
+	}
+	p.msgMgr.SetHistorySize(config.HistorySize)
+	p.msgMgr.SetNotifyPriorities(config.DeliveryNotifyPriority, config.ErrorNotifyPriority, config.StatusNotifyPriority)
+	p.msgMgr.SetNotifyTemplates(config.notifyTemplates)
+	p.msgMgr.SetLanguage(config.Language)
+	p.jsonLogs.Store(config.JSONLogs)
+	// 运行中切换 backend 时随之启动或停止后台刷新 token
+	p.syncTokenRefresherLocked()
 	p.mu.Unlock()
 
 	return nil
 }
+
+// validateDateLayout 检查时间格式是否包含至少一个 Go 时间占位符
+// 用与参考时间各字段都不同的时间格式化，结果与原文相同说明没有任何占位符
+func validateDateLayout(layout string) error {
+	probe := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	if probe.Format(layout) == layout {
+		return fmt.Errorf("invalid date_layout %q: no time elements, use Go reference time like %q", layout, defaultDateLayout)
+	}
+	return nil
+}
+
+// formatDate 按配置的时区和格式渲染时间
+func (c *Config) formatDate(t time.Time) string {
+	return t.In(c.loc()).Format(c.DateLayout)
+}
+
+// defaultQuietMinPriority 免打扰时段默认仍然转发的最低优先级
+const defaultQuietMinPriority = 8
+
+// parseClock 解析 HH:MM，返回当日分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q should be HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inQuietHours 判断 t 是否处于免打扰时段，支持跨越午夜的时段（如 22:00-07:00）
+func (c *Config) inQuietHours(t time.Time) bool {
+	if !c.quietEnabled {
+		return false
+	}
+	local := t.In(c.loc())
+	now := local.Hour()*60 + local.Minute()
+	if c.quietStart < c.quietEnd {
+		return now >= c.quietStart && now < c.quietEnd
+	}
+	return now >= c.quietStart || now < c.quietEnd
+}
+
+// loc 返回配置的时区，未配置时使用服务器本地时区
+func (c *Config) loc() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
+
+// appName 返回 appid 对应的应用名称，未映射时返回数字 ID
+func (c *Config) appName(appID int64) string {
+	if name := strings.TrimSpace(c.AppNames[appID]); name != "" {
+		return name
+	}
+	return fmt.Sprintf("App %d", appID)
+}
+
+// excludedApp 判断 appID 是否在 excluded_app_ids 中
+func (c *Config) excludedApp(appID int64) bool {
+	for _, id := range c.ExcludedAppIDs {
+		if id == appID {
+			return true
+		}
+	}
+	return false
+}
+
+// userAgent 返回调用微信接口时使用的 User-Agent
+func (c *Config) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return "gotify-wechat-plugin/" + GetGotifyPluginInfo().Version
+}
+
+// streamConfigProblem 以 lang 语言返回消息流配置不完整、无法启动时缺少的内容，配置完整或未配置消息流时返回空字符串
+func (c *Config) streamConfigProblem(lang string) string {
+	hasToken := strings.TrimSpace(c.ClientToken) != ""
+	hasRoutes := len(c.MessageRoutes) > 0 || len(c.Routes) > 0
+	switch {
+	case hasToken && !hasRoutes:
+		return translate(lang, "stream_problem_routes")
+	case !hasToken && hasRoutes:
+		return translate(lang, "stream_problem_token")
+	}
+	return ""
+}
+
+// appLabel 返回状态展示用的应用标签：已映射时为「名称 (appid N)」，否则为「appid N」
+func (c *Config) appLabel(appID int64) string {
+	if name := strings.TrimSpace(c.AppNames[appID]); name != "" {
+		return fmt.Sprintf("%s (appid %d)", name, appID)
+	}
+	return fmt.Sprintf("appid %d", appID)
+}
+
+// 优先级级别，与语言无关，显示时翻译为 priority_<级别> 文案
+const (
+	priorityLow    = "low"
+	priorityMedium = "medium"
+	priorityHigh   = "high"
+)
+
+// priorityLevel 将 Gotify 优先级转换为级别
+func priorityLevel(priority int) string {
+	switch {
+	case priority >= 8:
+		return priorityHigh
+	case priority >= 4:
+		return priorityMedium
+	default:
+		return priorityLow
+	}
+}
+
+// priorityLabel 返回优先级在 language 下的级别标签（低/中/高 或 low/medium/high）
+func (c *Config) priorityLabel(priority int) string {
+	return c.text("priority_" + priorityLevel(priority))
+}
+
+// defaultRetryBudgetPerRecipient 未配置重试预算时，每个接收者分摊的重试次数
+const defaultRetryBudgetPerRecipient = 2
+
+// fanoutRetryBudget 返回一次扇出（发送给 recipients 个接收者）的共享重试预算
+func (c *Config) fanoutRetryBudget(recipients int) int {
+	if c.FanoutRetryBudget > 0 {
+		return c.FanoutRetryBudget
+	}
+	return recipients * defaultRetryBudgetPerRecipient
+}
+
+// fallbackRecipientName 备用接收者在统计和投递记录中的名称
+const fallbackRecipientName = "fallback"
+
+// fallbackRecipients 返回 fallback_recipients 对应的接收者
+func (c *Config) fallbackRecipients() []Recipient {
+	recipients := make([]Recipient, 0, len(c.FallbackRecipients))
+	for _, openid := range c.FallbackRecipients {
+		recipients = append(recipients, Recipient{Name: fallbackRecipientName, OpenID: openid})
+	}
+	return recipients
+}
+
+// describeTarget 返回用于日志和错误信息的脱敏接收者标识
+func (c *Config) describeTarget(r Recipient) string {
+	if c.Backend == backendWorkBot {
+		return "bot " + r.Name
+	}
+	return "openid " + maskString(r.OpenID)
+}
+
+// account 按名称查找公众号账号，空名称或 default 返回顶层凭据组成的默认账号
+func (c *Config) account(name string) (Account, bool) {
+	if name == "" || name == defaultAccountName {
+		return Account{
+			Name:       defaultAccountName,
+			AppID:      c.AppID,
+			AppSecret:  c.AppSecret,
+			TemplateID: c.TemplateID,
+		}, true
+	}
+	for _, a := range c.Accounts {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Account{}, false
+}
+
+// allAccounts 返回默认账号及 accounts 中配置的所有账号，默认账号在最前
+func (c *Config) allAccounts() []Account {
+	def, _ := c.account("")
+	return append([]Account{def}, c.Accounts...)
+}
+
+// templateFor 返回接收者使用的模板 ID；接收者的覆盖仅对默认账号生效，其他账号使用账号自身的模板
+func (c *Config) templateFor(r Recipient, acct Account) string {
+	if r.TemplateID != "" && acct.Name == defaultAccountName {
+		return r.TemplateID
+	}
+	return acct.TemplateID
+}
+
+// jumpURLFor 返回接收者的跳转链接，未覆盖时使用全局 JumpURL
+// 路由的 jump_url 在解析接收者时已写入 r.JumpURL，因此优先级为路由 > 接收者 > 全局
+func (c *Config) jumpURLFor(r Recipient) string {
+	if r.JumpURL != "" {
+		return r.JumpURL
+	}
+	return c.JumpURL
+}
+
+// miniProgram 返回模板消息的小程序跳转配置，未配置时返回 nil
+func (c *Config) miniProgram() *TemplateMiniProgram {
+	if c.MiniProgramAppID == "" {
+		return nil
+	}
+	return &TemplateMiniProgram{AppID: c.MiniProgramAppID, PagePath: c.MiniProgramPagePath}
+}
+
+// validateJumpURL 检查跳转链接，为空或 http(s) 地址时通过
+func validateJumpURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid jump_url %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid jump_url %q, should start with http:// or https://", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid jump_url %q, host is missing", raw)
+	}
+	return nil
+}
+
+// validateWebhookURL 检查群机器人 webhook 地址是否为 http(s) 地址
+func validateWebhookURL(raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return fmt.Errorf("webhook_url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook_url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook_url %q, should be an http(s) URL", raw)
+	}
+	return nil
+}
+
+// parseProxyURL 解析代理地址，为空时返回 nil（使用环境变量）
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy_url: unsupported scheme %q, should be http, https or socks5", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy_url: missing host")
+	}
+	return parsed, nil
+}
+
+// normalizeGotifyURL 将 gotify_url 规范化为 Gotify 服务器的 http(s) 根地址：允许省略 scheme，
+// ws/wss 转换为 http/https，保留端口、子路径和查询参数，去掉末尾的斜杠和已包含的 /stream，
+// 重复规范化结果不变
+func normalizeGotifyURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gotify_url: %w", err)
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "ws":
+		parsed.Scheme = "http"
+	case "https", "wss":
+		parsed.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("invalid gotify_url: unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, fmt.Errorf("invalid gotify_url: missing host")
+	}
+	if parsed.User != nil {
+		return nil, fmt.Errorf("invalid gotify_url: credentials in the URL are not supported, use client_token")
+	}
+
+	path := strings.TrimRight(parsed.Path, "/")
+	path = strings.TrimRight(strings.TrimSuffix(path, "/stream"), "/")
+	parsed.Path = path
+	parsed.RawPath = ""
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	// token 由插件按 client_token 设置，不保留地址中的值
+	q := parsed.Query()
+	q.Del("token")
+	parsed.RawQuery = q.Encode()
+	return parsed, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultDeadLetterSize 默认保留的死信数
+const defaultDeadLetterSize = 100
+
+// DeadLetter 重试后仍发送失败的消息，保存在插件存储中以便查看和重发
+type DeadLetter struct {
+	ID        int64             `json:"id"`
+	Time      time.Time         `json:"time"`
+	Recipient string            `json:"recipient"`
+	Target    string            `json:"target"` // 脱敏的 OpenID 或群机器人名称
+	Title     string            `json:"title"`
+	Content   string            `json:"content"`
+	Priority  int               `json:"priority"`
+	AppID     int64             `json:"appid,omitempty"`
+	Account   string            `json:"account,omitempty"`
+	ImageURL  string            `json:"image_url,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Errcode   int               `json:"errcode,omitempty"` // 微信错误码，非微信接口错误时为 0
+	Error     string            `json:"error"`
+}
+
+// newDeadLetter 根据发送失败的结果创建死信
+func (p *WeChatPlugin) newDeadLetter(r Recipient, msg OutgoingMessage, err error) DeadLetter {
+	dl := DeadLetter{
+		Time:      time.Now(),
+		Recipient: r.Name,
+		Target:    p.configSnapshot().describeTarget(r),
+		Title:     msg.Title,
+		Content:   msg.Content,
+		Priority:  msg.Priority,
+		AppID:     msg.AppID,
+		Account:   msg.Account,
+		ImageURL:  msg.ImageURL,
+		Fields:    msg.Fields,
+		Error:     err.Error(),
+	}
+	var we *WeChatError
+	if errors.As(err, &we) {
+		dl.Errcode = we.Code
+	}
+	return dl
+}
+
+// message 还原死信对应的待发送消息
+func (dl DeadLetter) message() OutgoingMessage {
+	return OutgoingMessage{
+		Title:    dl.Title,
+		Content:  dl.Content,
+		Priority: dl.Priority,
+		Date:     dl.Time,
+		AppID:    dl.AppID,
+		Account:  dl.Account,
+		ImageURL: dl.ImageURL,
+		Fields:   dl.Fields,
+	}
+}
+
+// addDeadLetters 写入死信，超出 DeadLetterSize 时丢弃最旧的记录；DeadLetterSize 为 0 时不记录
+func (p *WeChatPlugin) addDeadLetters(letters []DeadLetter) {
+	size := p.configSnapshot().DeadLetterSize
+	if len(letters) == 0 || size == 0 {
+		return
+	}
+
+	err := p.updateStorage(func(data *pluginStorage) {
+		for _, dl := range letters {
+			data.DeadLetterSeq++
+			dl.ID = data.DeadLetterSeq
+			data.DeadLetters = append(data.DeadLetters, dl)
+		}
+		if n := len(data.DeadLetters); n > size {
+			data.DeadLetters = append([]DeadLetter(nil), data.DeadLetters[n-size:]...)
+		}
+	})
+	if err != nil {
+		p.logEvent(levelError, "storage_error", logFields{"error": err}, "Failed to persist dead letters: %v", err)
+	}
+}
+
+// deadLetters 返回保存的死信，从旧到新
+func (p *WeChatPlugin) deadLetters() ([]DeadLetter, error) {
+	data, err := p.loadStorage()
+	if err != nil {
+		return nil, err
+	}
+	if data.DeadLetters == nil {
+		return []DeadLetter{}, nil
+	}
+	return data.DeadLetters, nil
+}
+
+// deadLetterRetryResult 重发死信的结果
+type deadLetterRetryResult struct {
+	Retried   int `json:"retried"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Remaining int `json:"remaining"`
+}
+
+// retryDeadLetters 逐条重发死信，ids 为空时重发全部；成功的从存储中移除，失败的更新错误信息
+func (p *WeChatPlugin) retryDeadLetters(ids []int64) (deadLetterRetryResult, error) {
+	var res deadLetterRetryResult
+
+	letters, err := p.deadLetters()
+	if err != nil {
+		return res, err
+	}
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	ctx, ok := p.beginSend()
+	if !ok {
+		return res, errShuttingDown
+	}
+	defer p.sends.Done()
+
+	done := make(map[int64]bool)
+	failed := make(map[int64]DeadLetter)
+	for _, dl := range letters {
+		if len(wanted) > 0 && !wanted[dl.ID] {
+			continue
+		}
+		res.Retried++
+
+		r, found := p.findRecipient(dl.Recipient)
+		if !found {
+			err = fmt.Errorf("unknown recipient %q", dl.Recipient)
+		} else {
+			_, err = p.sendToWeChat(ctx, r, dl.message(), nil)
+			p.msgMgr.RecordRecipient(r.Name, err == nil)
+		}
+		if err != nil {
+			res.Failed++
+			updated := dl
+			updated.Time = time.Now()
+			updated.Error = err.Error()
+			updated.Errcode = 0
+			var we *WeChatError
+			if errors.As(err, &we) {
+				updated.Errcode = we.Code
+			}
+			failed[dl.ID] = updated
+			continue
+		}
+		res.Succeeded++
+		done[dl.ID] = true
+	}
+	if res.Succeeded > 0 {
+		p.msgMgr.RecordSuccess(res.Succeeded)
+	}
+	if res.Failed > 0 {
+		p.msgMgr.RecordFailure(res.Failed)
+	}
+
+	// 重发期间可能有新的死信写入，按 ID 合并而不是整体覆盖
+	err = p.updateStorage(func(data *pluginStorage) {
+		kept := data.DeadLetters[:0]
+		for _, dl := range data.DeadLetters {
+			if done[dl.ID] {
+				continue
+			}
+			if updated, ok := failed[dl.ID]; ok {
+				dl = updated
+			}
+			kept = append(kept, dl)
+		}
+		data.DeadLetters = kept
+		res.Remaining = len(kept)
+	})
+	return res, err
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkWebhookSecret 校验 X-Webhook-Secret 请求头，失败时写入错误响应并返回 false
+// required 为 true 时未配置 webhook_secret 也拒绝访问
+func (p *WeChatPlugin) checkWebhookSecret(c *gin.Context, required bool) bool {
+	p.mu.RLock()
+	secret := ""
+	if p.config != nil {
+		secret = p.config.WebhookSecret
+	}
+	p.mu.RUnlock()
+
+	if secret == "" {
+		if required {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "webhook_secret is not configured",
+			})
+			return false
+		}
+		return true
+	}
+
+	given := c.GetHeader("X-Webhook-Secret")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid webhook secret",
+		})
+		return false
+	}
+	return true
+}
+
+// maskSecret 完全隐藏密钥，仅表明是否已配置
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "****"
+}
+
+// formatTime 格式化时间，零值返回空字符串
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// redactProxyURL 隐藏代理地址中的密码
+func redactProxyURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// tokenValid 返回 appID 对应的缓存中是否有未过期的 access_token，不会触发获取
+func (p *WeChatPlugin) tokenValid(appID string) bool {
+	p.tokenMu.Lock()
+	cache, ok := p.tokenCaches[appID]
+	p.tokenMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.Token != "" && time.Now().Before(cache.ExpiresAt)
+}
+
+// tokenStatus 返回 appID 对应 access_token 缓存的脱敏状态
+func (p *WeChatPlugin) tokenStatus(appID string) gin.H {
+	p.tokenMu.Lock()
+	cache, ok := p.tokenCaches[appID]
+	p.tokenMu.Unlock()
+	if !ok {
+		return gin.H{"cached": false}
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	if cache.Token == "" {
+		return gin.H{"cached": false}
+	}
+	return gin.H{
+		"cached":     true,
+		"token":      maskString(cache.Token),
+		"expires_at": formatTime(cache.ExpiresAt),
+		"valid":      time.Now().Before(cache.ExpiresAt),
+	}
+}
+
+// debugSnapshot 汇总插件内部状态，所有密钥和 OpenID 均脱敏
+func (p *WeChatPlugin) debugSnapshot() gin.H {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := gin.H{
+		"enabled":    p.enabled,
+		"configured": p.config != nil,
+		"user":       p.userCtx.Name,
+	}
+
+	byRecipient := p.msgMgr.RecipientStats()
+
+	if cfg := p.config; cfg != nil {
+		recipients := make([]gin.H, 0, len(cfg.Recipients))
+		for _, r := range p.getAllRecipients() {
+			recipients = append(recipients, gin.H{
+				"name":         r.Name,
+				"openid":       maskString(r.OpenID),
+				"webhook_url":  maskSecret(r.WebhookURL),
+				"template_id":  maskString(r.TemplateID),
+				"jump_url":     r.JumpURL,
+				"min_priority": r.MinPriority,
+				"sent":         byRecipient[r.Name].Sent,
+				"failed":       byRecipient[r.Name].Failed,
+				"filtered":     byRecipient[r.Name].Filtered,
+			})
+		}
+
+		routes := make([]string, 0, len(cfg.MessageRoutes))
+		for _, route := range cfg.MessageRoutes {
+			routes = append(routes, route.Path)
+		}
+
+		fallbacks := make([]string, 0, len(cfg.FallbackRecipients))
+		for _, openid := range cfg.FallbackRecipients {
+			fallbacks = append(fallbacks, maskString(openid))
+		}
+
+		accounts := make([]gin.H, 0, len(cfg.Accounts))
+		for _, a := range cfg.Accounts {
+			accounts = append(accounts, gin.H{
+				"name":        a.Name,
+				"appid":       maskString(a.AppID),
+				"app_secret":  maskSecret(a.AppSecret),
+				"template_id": maskString(a.TemplateID),
+			})
+		}
+
+		snapshot["config"] = gin.H{
+			"accounts":                    accounts,
+			"backend":                     cfg.Backend,
+			"work_bot_markdown":           cfg.WorkBotMarkdown,
+			"message_api":                 cfg.MessageAPI,
+			"appid":                       maskString(cfg.AppID),
+			"app_secret":                  maskSecret(cfg.AppSecret),
+			"template_id":                 maskString(cfg.TemplateID),
+			"jump_url":                    cfg.JumpURL,
+			"miniprogram_appid":           maskString(cfg.MiniProgramAppID),
+			"miniprogram_pagepath":        cfg.MiniProgramPagePath,
+			"gotify_url":                  cfg.GotifyURL,
+			"client_token":                maskSecret(cfg.ClientToken),
+			"stream_token_in_query":       cfg.StreamTokenInQuery,
+			"ping_interval":               cfg.PingInterval.String(),
+			"stream_handshake_timeout":    cfg.StreamHandshakeTimeout.String(),
+			"skip_tls_verify":             cfg.SkipTLSVerify,
+			"dedup_window":                cfg.DedupWindow,
+			"reconnect_initial_backoff":   cfg.ReconnectInitialBackoff.String(),
+			"reconnect_max_backoff":       cfg.ReconnectMaxBackoff.String(),
+			"reconnect_jitter":            cfg.ReconnectJitter,
+			"disable_stream_error_notify": cfg.DisableStreamErrorNotify,
+			"stream_error_threshold":      cfg.StreamErrorThreshold,
+			"webhook_secret":              maskSecret(cfg.WebhookSecret),
+			"enable_send_endpoint":        cfg.EnableSendEndpoint,
+			"enable_test_endpoint":        cfg.EnableTestEndpoint,
+			"disable_self_notify":         cfg.DisableSelfNotify,
+			"delivery_notify_priority":    cfg.DeliveryNotifyPriority,
+			"error_notify_priority":       cfg.ErrorNotifyPriority,
+			"status_notify_priority":      cfg.StatusNotifyPriority,
+			"status_notify_title":         cfg.StatusNotifyTitle,
+			"status_notify_message":       cfg.StatusNotifyMessage,
+			"delivery_notify_title":       cfg.DeliveryNotifyTitle,
+			"delivery_notify_message":     cfg.DeliveryNotifyMessage,
+			"error_notify_title":          cfg.ErrorNotifyTitle,
+			"error_notify_message":        cfg.ErrorNotifyMessage,
+			"language":                    cfg.Language,
+			"message_routes":              routes,
+			"routes":                      cfg.Routes,
+			"fallback_recipients":         fallbacks,
+			"excluded_app_ids":            cfg.ExcludedAppIDs,
+			"global_min_priority":         cfg.GlobalMinPriority,
+			"template_field_map":          cfg.TemplateFieldMap,
+			"extras_fields_key":           cfg.ExtrasFieldsKey,
+			"field_color":                 cfg.FieldColor,
+			"priority_colors":             cfg.PriorityColors,
+			"top_color":                   cfg.TopColor,
+			"date_field":                  cfg.DateField,
+			"date_layout":                 cfg.DateLayout,
+			"timezone":                    cfg.Timezone,
+			"app_names":                   cfg.AppNames,
+			"prefix_app_name":             cfg.PrefixAppName,
+			"source_field":                cfg.SourceField,
+			"level_field":                 cfg.LevelField,
+			"normalize_unicode":           cfg.NormalizeUnicode,
+			"strip_combining_marks":       cfg.StripCombiningMarks,
+			"http_timeout":                cfg.HTTPTimeout.String(),
+			"proxy_url":                   redactProxyURL(cfg.ProxyURL),
+			"wechat_skip_tls_verify":      cfg.WeChatSkipTLSVerify,
+			"user_agent":                  cfg.userAgent(),
+			"token_refresh_margin":        cfg.TokenRefreshMargin.String(),
+			"max_retries":                 cfg.MaxRetries,
+			"retry_backoff":               cfg.RetryBackoff.String(),
+			"fanout_retry_budget":         cfg.FanoutRetryBudget,
+			"max_concurrency":             cfg.MaxConcurrency,
+			"min_send_interval":           cfg.MinSendInterval.String(),
+			"canary_interval":             cfg.CanaryInterval.String(),
+			"canary_recipient":            cfg.CanaryRecipient,
+			"forward_limit":               cfg.ForwardLimit,
+			"message_template":            cfg.MessageTemplate,
+			"flatten_markdown":            cfg.FlattenMarkdown,
+			"force_plain_text":            cfg.ForcePlainText,
+			"digest_window":               cfg.DigestWindow.String(),
+			"digest_max_count":            cfg.DigestMaxCount,
+			"quiet_start":                 cfg.QuietStart,
+			"quiet_end":                   cfg.QuietEnd,
+			"quiet_min_priority":          cfg.QuietMinPriority,
+			"include_priority":            cfg.IncludePriority,
+			"include_timestamp":           cfg.IncludeTimestamp,
+			"content_prefix":              cfg.ContentPrefix,
+			"content_suffix":              cfg.ContentSuffix,
+			"max_title_runes":             cfg.MaxTitleRunes,
+			"max_content_runes":           cfg.MaxContentRunes,
+			"max_message_bytes":           cfg.MaxMessageBytes,
+			"oversize_action":             cfg.OversizeAction,
+			"history_size":                cfg.HistorySize,
+			"dead_letter_size":            cfg.DeadLetterSize,
+			"stats_flush_interval":        cfg.StatsFlushInterval.String(),
+			"json_logs":                   cfg.JSONLogs,
+		}
+		snapshot["recipients"] = recipients
+	}
+
+	if cfg := p.config; cfg != nil {
+		tokens := gin.H{defaultAccountName: p.tokenStatus(cfg.AppID)}
+		for _, a := range cfg.Accounts {
+			tokens[a.Name] = p.tokenStatus(a.AppID)
+		}
+		snapshot["token"] = tokens[defaultAccountName]
+		snapshot["tokens"] = tokens
+	}
+
+	stream := gin.H{"running": p.stream != nil}
+	if p.stream != nil {
+		since := p.stream.ConnectedSince()
+		stream["connected"] = p.stream.Connected()
+		stream["connected_since"] = formatTime(since)
+		if !since.IsZero() {
+			stream["uptime"] = time.Since(since).Round(time.Second).String()
+		}
+		stream["reconnects"] = p.stream.Reconnects()
+		stream["auth_failed"] = p.stream.AuthFailed()
+		forwarded, filtered := p.stream.Forwarded()
+		stream["forwarded"] = forwarded
+		stream["filtered"] = filtered
+		stream["last_message_at"] = formatTime(p.stream.LastMessageAt())
+	}
+	snapshot["stream"] = stream
+
+	sent, failed, lastSent, lastErr := p.msgMgr.Stats()
+	filtered, _ := p.msgMgr.Filtered()
+	snapshot["stats"] = gin.H{
+		"sent":        sent,
+		"failed":      failed,
+		"filtered":    filtered,
+		"escalations": p.msgMgr.Escalations(),
+		"last_sent":   formatTime(lastSent),
+		"last_error": gin.H{
+			"message":    lastErr.Message,
+			"count":      lastErr.Count,
+			"first_seen": formatTime(lastErr.FirstSeen),
+			"last_seen":  formatTime(lastErr.LastSeen),
+		},
+	}
+
+	snapshot["forwarding"] = gin.H{
+		"forwarded": p.forwarded.Load(),
+		"paused":    p.paused.Load(),
+		"in_flight": p.inFlight.Load(),
+	}
+
+	var batches, buffered int
+	if p.stream != nil {
+		batches, buffered = p.stream.DigestPending()
+	}
+	snapshot["queue"] = gin.H{
+		"digest_batches":  batches,
+		"digest_messages": buffered,
+		"limiter_waiters": p.limiter.Load().waiters(),
+	}
+
+	if cfg := p.configSnapshot(); cfg != nil {
+		snapshot["quota"] = gin.H{
+			"sent_today": p.sentToday(cfg),
+			"warn":       cfg.DailyQuotaWarn,
+			"hard":       cfg.DailyQuotaHard,
+		}
+	}
+
+	canary := gin.H{"degraded": p.degraded.Load()}
+	if res, ok := p.canaryStatus(); ok {
+		canary["last_check"] = formatTime(res.At)
+		canary["last_error"] = res.Err
+	}
+	snapshot["canary"] = canary
+
+	return snapshot
+}
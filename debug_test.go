@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestDebugSnapshotMasksSecrets 调试快照中不能出现原始的密钥、token 和 OpenID
+func TestDebugSnapshotMasksSecrets(t *testing.T) {
+	const accessToken = "ACCESS_TOKEN_abcdefghijklmnopqrstuvwxyz0123456789"
+	mock := &mockWeChat{token: func(bool) AccessTokenResponse {
+		return AccessTokenResponse{AccessToken: accessToken, ExpiresIn: 7200}
+	}}
+	c := testConfig()
+	c.ClientToken = "CgotifyClientToken1234"
+	c.WebhookSecret = "webhook-secret-0123456789"
+	c.FallbackRecipients = []string{"o765432109876543210987654321"}
+	p := newTestPlugin(t, mock, c)
+	if err := p.Enable(); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	defer p.Disable()
+
+	if _, err := p.sendToWeChat(context.Background(), p.getAllRecipients()[0], OutgoingMessage{Title: "title", Content: "content"}, nil); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	raw, err := json.Marshal(p.debugSnapshot())
+	if err != nil {
+		t.Fatalf("marshal snapshot: %v", err)
+	}
+	snapshot := string(raw)
+	for name, secret := range map[string]string{
+		"app_secret":         c.AppSecret,
+		"client_token":       c.ClientToken,
+		"webhook_secret":     c.WebhookSecret,
+		"access_token":       accessToken,
+		"openid":             c.OpenID,
+		"fallback_recipient": c.FallbackRecipients[0],
+	} {
+		if strings.Contains(snapshot, secret) {
+			t.Errorf("snapshot contains raw %s", name)
+		}
+	}
+	if !strings.Contains(snapshot, `"queue"`) {
+		t.Error("snapshot has no queue section")
+	}
+}
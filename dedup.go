@@ -0,0 +1,52 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// idSet 有界的最近消息 ID 集合，超出容量时淘汰最久未出现的 ID
+type idSet struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // 最近出现的在前
+	items map[int64]*list.Element
+}
+
+// newIDSet 创建容量为 size 的 ID 集合，size 为 0 时不去重
+func newIDSet(size int) *idSet {
+	return &idSet{
+		size:  size,
+		order: list.New(),
+		items: make(map[int64]*list.Element),
+	}
+}
+
+// add 记录 id，id 已在集合中时返回 false
+func (s *idSet) add(id int64) bool {
+	if s.size <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.items[id]; ok {
+		s.order.MoveToFront(e)
+		return false
+	}
+	s.items[id] = s.order.PushFront(id)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(int64))
+	}
+	return true
+}
+
+// clear 清空集合
+func (s *idSet) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.order.Init()
+	s.items = make(map[int64]*list.Element)
+}
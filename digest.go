@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDigestMaxCount 默认每批合并的最大消息数
+const defaultDigestMaxCount = 10
+
+// digestBatch 发送给同一组接收者、等待合并的消息
+type digestBatch struct {
+	recipients []Recipient
+	messages   []OutgoingMessage
+	timer      *time.Timer
+}
+
+// digestBuffer 在 window 内缓冲消息，按接收者分组合并为一条推送
+// 窗口从每批第一条消息开始计时，到期或达到 maxCount 条时立即发送
+type digestBuffer struct {
+	window   time.Duration
+	maxCount int
+	send     func([]Recipient, []OutgoingMessage) // 发送一批消息，由调用方合并
+
+	mu      sync.Mutex
+	batches map[string]*digestBatch
+	closed  bool // flushAll 后置位，之后到达的消息直接发送，不再创建批次和定时器
+}
+
+// newDigestBuffer 创建合并缓冲区
+func newDigestBuffer(window time.Duration, maxCount int, send func([]Recipient, []OutgoingMessage)) *digestBuffer {
+	return &digestBuffer{
+		window:   window,
+		maxCount: maxCount,
+		send:     send,
+		batches:  make(map[string]*digestBatch),
+	}
+}
+
+// digestKey 以发送账号和接收者名称组合作为分组键
+func digestKey(account string, recipients []Recipient) string {
+	names := make([]string, 0, len(recipients)+1)
+	names = append(names, account)
+	for _, r := range recipients {
+		names = append(names, r.Name)
+	}
+	return strings.Join(names, "\x00")
+}
+
+// add 缓冲一条消息；缓冲区已由 flushAll 关闭时直接发送
+func (d *digestBuffer) add(recipients []Recipient, msg OutgoingMessage) {
+	key := digestKey(msg.Account, recipients)
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		d.send(recipients, []OutgoingMessage{msg})
+		return
+	}
+	b, ok := d.batches[key]
+	if !ok {
+		b = &digestBatch{recipients: recipients}
+		d.batches[key] = b
+		b.timer = time.AfterFunc(d.window, func() { d.flush(key, b) })
+	}
+	b.messages = append(b.messages, msg)
+	full := d.maxCount > 0 && len(b.messages) >= d.maxCount
+	d.mu.Unlock()
+
+	if full {
+		d.flush(key, b)
+	}
+}
+
+// flush 发送一批消息，批次已被发送时不做任何事
+func (d *digestBuffer) flush(key string, b *digestBatch) {
+	d.mu.Lock()
+	if d.batches[key] != b {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.batches, key)
+	b.timer.Stop()
+	d.mu.Unlock()
+
+	d.send(b.recipients, b.messages)
+}
+
+// flushAll 立即发送所有缓冲中的消息并关闭缓冲区，在消息流停止时调用：
+// 停止后仍在运行的转发协程不会再创建批次，避免定时器在停用或切换配置后才触发
+func (d *digestBuffer) flushAll() {
+	d.mu.Lock()
+	pending := d.batches
+	d.batches = make(map[string]*digestBatch)
+	d.closed = true
+	d.mu.Unlock()
+
+	for _, b := range pending {
+		b.timer.Stop()
+		d.send(b.recipients, b.messages)
+	}
+}
+
+// pending 返回缓冲中的批次数和消息数
+func (d *digestBuffer) pending() (batches, messages int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, b := range d.batches {
+		messages += len(b.messages)
+	}
+	return len(d.batches), messages
+}
+
+// mergeDigest 将多条消息合并为一条，标题按 lang 生成：优先级取最高，时间取最新，来源应用不一致时置空
+func mergeDigest(msgs []OutgoingMessage, lang string) OutgoingMessage {
+	if len(msgs) == 1 {
+		return msgs[0]
+	}
+
+	merged := OutgoingMessage{
+		Title:   translate(lang, "digest_title", len(msgs)),
+		AppID:   msgs[0].AppID,
+		Account: msgs[0].Account,
+	}
+	parts := make([]string, len(msgs))
+	for i, m := range msgs {
+		parts[i] = translate(lang, "digest_item", m.Title, m.Content)
+		if m.Priority > merged.Priority {
+			merged.Priority = m.Priority
+		}
+		if m.Date.After(merged.Date) {
+			merged.Date = m.Date
+		}
+		if m.AppID != merged.AppID {
+			merged.AppID = 0
+		}
+	}
+	merged.Content = strings.Join(parts, "\n")
+	return merged
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// digestRecorder 记录 digestBuffer 发出的批次
+type digestRecorder struct {
+	mu      sync.Mutex
+	batches [][]OutgoingMessage
+}
+
+func (r *digestRecorder) send(_ []Recipient, msgs []OutgoingMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, msgs)
+}
+
+func (r *digestRecorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sizes := make([]int, len(r.batches))
+	for i, b := range r.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+var digestRecipients = []Recipient{{Name: "alice", OpenID: "o123456789012345678901234567"}}
+
+func TestDigestFlushesOnMaxCountAndWindow(t *testing.T) {
+	rec := &digestRecorder{}
+	d := newDigestBuffer(50*time.Millisecond, 3, rec.send)
+	for i := 0; i < 4; i++ {
+		d.add(digestRecipients, OutgoingMessage{Title: "title"})
+	}
+	if got := rec.sizes(); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("batches after max count = %v, want [3]", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.sizes()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("window did not flush the remaining message")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := rec.sizes(); got[1] != 1 {
+		t.Errorf("batches after window = %v, want [3 1]", got)
+	}
+}
+
+// TestDigestAddAfterFlushAll flushAll 之后到达的消息应直接发送，不留下待触发的定时器
+func TestDigestAddAfterFlushAll(t *testing.T) {
+	rec := &digestRecorder{}
+	d := newDigestBuffer(20*time.Millisecond, 10, rec.send)
+	d.add(digestRecipients, OutgoingMessage{Title: "before stop"})
+	d.flushAll()
+	if got := rec.sizes(); len(got) != 1 {
+		t.Fatalf("batches after flushAll = %v, want 1 batch", got)
+	}
+
+	d.add(digestRecipients, OutgoingMessage{Title: "after stop"})
+	d.mu.Lock()
+	pending := len(d.batches)
+	d.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d batches pending after flushAll, want 0", pending)
+	}
+	if got := rec.sizes(); len(got) != 2 || got[1] != 1 {
+		t.Errorf("batches = %v, want the late message sent immediately", got)
+	}
+
+	// 等待超过合并窗口，确认没有定时器再次发送
+	time.Sleep(60 * time.Millisecond)
+	if got := rec.sizes(); len(got) != 2 {
+		t.Errorf("batches after window = %v, want no more sends", got)
+	}
+}
+
+// TestDigestPending pending 按批次统计缓冲中的消息，发送后清零
+func TestDigestPending(t *testing.T) {
+	rec := &digestRecorder{}
+	d := newDigestBuffer(time.Hour, 0, rec.send)
+	d.add(digestRecipients, OutgoingMessage{Title: "a"})
+	d.add(digestRecipients, OutgoingMessage{Title: "b"})
+	d.add(digestRecipients, OutgoingMessage{Title: "c", Account: "ops"})
+	if batches, msgs := d.pending(); batches != 2 || msgs != 3 {
+		t.Errorf("pending = %d batches, %d messages, want 2, 3", batches, msgs)
+	}
+
+	d.flushAll()
+	if batches, msgs := d.pending(); batches != 0 || msgs != 0 {
+		t.Errorf("pending after flushAll = %d batches, %d messages, want 0, 0", batches, msgs)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errcodeClass 微信错误码的处理方式
+type errcodeClass int
+
+const (
+	errcodePermanent     errcodeClass = iota // 重试无效，直接失败
+	errcodeRetryable                         // 临时错误，可按退避重试
+	errcodeTokenRejected                     // access_token 失效，刷新 token 后重发
+)
+
+// errcodeInfo 已知错误码的分类与说明
+type errcodeInfo struct {
+	class errcodeClass
+	desc  string // 说明在 messageCatalogs 中的键
+}
+
+// wechatErrcodes 公众号接口的已知错误码；未列出的错误码按永久错误处理
+var wechatErrcodes = map[int]errcodeInfo{
+	-1:    {errcodeRetryable, "errcode_busy"},
+	45011: {errcodeRetryable, "errcode_too_frequent"},
+	40001: {errcodeTokenRejected, "errcode_token_invalid"},
+	40014: {errcodeTokenRejected, "errcode_token_illegal"},
+	42001: {errcodeTokenRejected, "errcode_token_expired"},
+	40003: {errcodePermanent, "errcode_bad_openid"},
+	40013: {errcodePermanent, "errcode_bad_appid"},
+	40037: {errcodePermanent, "errcode_bad_template_id"},
+	40125: {errcodePermanent, "errcode_bad_secret"},
+	40164: {errcodePermanent, "errcode_ip_not_whitelisted"},
+	43004: {errcodePermanent, "errcode_not_following"},
+	43101: {errcodePermanent, "errcode_subscribe_rejected"},
+	45009: {errcodePermanent, "errcode_daily_limit"},
+	47003: {errcodePermanent, "errcode_bad_template_data"},
+	48001: {errcodePermanent, "errcode_unauthorized"},
+}
+
+// workBotErrcodes 企业微信群机器人的已知错误码；群机器人的 45009 表示每分钟频率限制，可重试
+var workBotErrcodes = map[int]errcodeInfo{
+	-1:    {errcodeRetryable, "errcode_busy"},
+	45009: {errcodeRetryable, "errcode_rate_limited"},
+	93000: {errcodePermanent, "errcode_bad_webhook"},
+	93008: {errcodePermanent, "errcode_bot_not_in_group"},
+}
+
+// WeChatError 微信接口返回的错误码
+type WeChatError struct {
+	Code int
+	Msg  string
+
+	api  string // 接口名称，用于错误信息
+	info errcodeInfo
+}
+
+// newWeChatError 根据公众号接口错误码创建错误
+func newWeChatError(code int, msg string) *WeChatError {
+	return &WeChatError{Code: code, Msg: msg, api: "WeChat", info: wechatErrcodes[code]}
+}
+
+// newWorkBotError 根据群机器人接口错误码创建错误
+func newWorkBotError(code int, msg string) *WeChatError {
+	return &WeChatError{Code: code, Msg: msg, api: "WeChat Work", info: workBotErrcodes[code]}
+}
+
+func (e *WeChatError) Error() string {
+	return fmt.Sprintf("%s API error: code=%d, msg=%s", e.api, e.Code, e.Msg)
+}
+
+// IsRetryable 错误是否为临时错误（如系统繁忙、频率限制），可按退避重试
+func (e *WeChatError) IsRetryable() bool {
+	return e.info.class == errcodeRetryable
+}
+
+// TokenRejected 错误是否表示 access_token 已失效
+func (e *WeChatError) TokenRejected() bool {
+	return e.info.class == errcodeTokenRejected
+}
+
+// errcodeHint 返回错误中已知微信错误码的说明，用于失败通知；未知错误码返回空字符串
+func errcodeHint(lang string, err error) string {
+	var we *WeChatError
+	if !errors.As(err, &we) || we.info.desc == "" {
+		return ""
+	}
+	switch we.info.class {
+	case errcodeRetryable:
+		return translate(lang, "errcode_hint_retryable", translate(lang, we.info.desc))
+	case errcodeTokenRejected:
+		return translate(lang, "errcode_hint_token", translate(lang, we.info.desc))
+	default:
+		return translate(lang, "errcode_hint_permanent", translate(lang, we.info.desc))
+	}
+}
+
+// errcodeWindow 错误码统计的时间窗口
+const errcodeWindow = time.Hour
+
+// errcodeHistoryMax 窗口内最多保留的错误码记录数
+const errcodeHistoryMax = 1000
+
+// ErrcodeCount 窗口内某个错误码出现的次数
+type ErrcodeCount struct {
+	Code  int `json:"code"`
+	Count int `json:"count"`
+}
+
+// errcodeEvent 一次出现的错误码
+type errcodeEvent struct {
+	code int
+	at   time.Time
+}
+
+// errcodeHistory 记录最近 errcodeWindow 内出现的微信错误码
+type errcodeHistory struct {
+	mu     sync.Mutex
+	events []errcodeEvent // 按时间从旧到新
+}
+
+// pruneLocked 丢弃窗口外的记录，调用方需持有 h.mu
+func (h *errcodeHistory) pruneLocked(now time.Time) {
+	cutoff := now.Add(-errcodeWindow)
+	i := 0
+	for i < len(h.events) && h.events[i].at.Before(cutoff) {
+		i++
+	}
+	if n := len(h.events) - i; n > errcodeHistoryMax {
+		i += n - errcodeHistoryMax
+	}
+	if i > 0 {
+		h.events = append(h.events[:0], h.events[i:]...)
+	}
+}
+
+// add 记录一次错误码
+func (h *errcodeHistory) add(code int, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, errcodeEvent{code: code, at: now})
+	h.pruneLocked(now)
+}
+
+// counts 返回窗口内各错误码的次数，按次数从多到少排列
+func (h *errcodeHistory) counts(now time.Time) []ErrcodeCount {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pruneLocked(now)
+
+	byCode := make(map[int]int)
+	for _, e := range h.events {
+		byCode[e.code]++
+	}
+	counts := make([]ErrcodeCount, 0, len(byCode))
+	for code, n := range byCode {
+		counts = append(counts, ErrcodeCount{Code: code, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Code < counts[j].Code
+	})
+	return counts
+}
+
+// reset 清空记录
+func (h *errcodeHistory) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = nil
+}
+
+// RecordErrcode 记录发送失败中的微信错误码，非微信接口错误时忽略
+func (m *MessageManager) RecordErrcode(err error) {
+	var we *WeChatError
+	if m == nil || !errors.As(err, &we) {
+		return
+	}
+	m.errcodes.add(we.Code, time.Now())
+}
+
+// RecentErrcodes 返回最近 errcodeWindow 内各微信错误码的次数
+func (m *MessageManager) RecentErrcodes() []ErrcodeCount {
+	if m == nil {
+		return nil
+	}
+	return m.errcodes.counts(time.Now())
+}
+
+// formatErrcodes 将错误码统计格式化为「40003 ×4, 45009 ×2」
+func formatErrcodes(counts []ErrcodeCount) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%d ×%d", c.Code, c.Count)
+	}
+	return strings.Join(parts, ", ")
+}
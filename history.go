@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultHistorySize 默认保留的投递记录数
+const defaultHistorySize = 50
+
+// DeliveryRecord 一次向接收者投递消息的结果
+type DeliveryRecord struct {
+	Time      time.Time `json:"time"`
+	Title     string    `json:"title"`
+	Recipient string    `json:"recipient"`
+	Target    string    `json:"target"` // 脱敏的 OpenID 或群机器人名称
+	Success   bool      `json:"success"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// deliveryHistory 固定容量的投递记录环形缓冲区，写满后覆盖最旧的记录
+type deliveryHistory struct {
+	mu      sync.Mutex
+	records []DeliveryRecord
+	next    int // 下一条记录写入的位置
+	count   int // 当前记录数
+}
+
+// resize 调整容量，保留最新的记录；size 为 0 时不再记录
+func (h *deliveryHistory) resize(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if size == len(h.records) {
+		return
+	}
+	latest := h.listLocked()
+	if len(latest) > size {
+		latest = latest[:size]
+	}
+	h.records = make([]DeliveryRecord, size)
+	h.count = len(latest)
+	h.next = h.count % max(size, 1)
+	// latest 为从新到旧，按从旧到新写回
+	for i := range latest {
+		h.records[i] = latest[len(latest)-1-i]
+	}
+}
+
+// add 追加一条记录
+func (h *deliveryHistory) add(rec DeliveryRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.records) == 0 {
+		return
+	}
+	h.records[h.next] = rec
+	h.next = (h.next + 1) % len(h.records)
+	if h.count < len(h.records) {
+		h.count++
+	}
+}
+
+// list 返回所有记录，最新的在前
+func (h *deliveryHistory) list() []DeliveryRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.listLocked()
+}
+
+func (h *deliveryHistory) listLocked() []DeliveryRecord {
+	out := make([]DeliveryRecord, 0, h.count)
+	for i := 1; i <= h.count; i++ {
+		idx := (h.next - i + len(h.records)) % len(h.records)
+		out = append(out, h.records[idx])
+	}
+	return out
+}
+
+// SetHistorySize 设置保留的投递记录数
+func (m *MessageManager) SetHistorySize(size int) {
+	if m == nil {
+		return
+	}
+	m.history.resize(size)
+}
+
+// RecordDelivery 记录一次投递结果
+func (m *MessageManager) RecordDelivery(rec DeliveryRecord) {
+	if m == nil {
+		return
+	}
+	m.history.add(rec)
+}
+
+// History 返回最近的投递记录，最新的在前
+func (m *MessageManager) History() []DeliveryRecord {
+	if m == nil {
+		return nil
+	}
+	return m.history.list()
+}
@@ -0,0 +1,250 @@
+package main
+
+import "fmt"
+
+// 插件生成文本（Gotify 通知、状态页）支持的语言
+const (
+	languageZH      = "zh"
+	languageEN      = "en"
+	defaultLanguage = languageZH
+)
+
+// messageCatalogs 内置的各语言文案，值为 fmt 格式串（stream_error_message 用于 fmt.Errorf）；通知的默认模板见 defaultNotifyTexts
+var messageCatalogs = map[string]map[string]string{
+	languageZH: {
+		"notify_enabled":             "启用",
+		"notify_disabled":            "停用",
+		"paused_title":               "微信推送已暂停",
+		"paused_message":             "已转发 %d 条消息，达到 forward_limit 上限，请调用 /resume 恢复转发",
+		"canary_title":               "微信推送自检失败",
+		"canary_message":             "向接收者 %s 发送的自检消息失败，微信推送可能已不可用:\n  - %s",
+		"stream_auth_title":          "微信推送消息流认证失败",
+		"stream_auth_message":        "Gotify 拒绝了 client_token，消息流已停止重连，请检查配置后调用 /reload 或重新启用插件:\n  - %s",
+		"quota_title":                "微信推送配额预警",
+		"quota_message":              "公众号 %s 今日已发送 %d 条模板消息，达到预警阈值 %d",
+		"quota_message_hard":         "，达到 %d 条后将停止发送",
+		"stream_problem_routes":      "已设置 client_token，但未配置 message_routes 或 routes",
+		"stream_problem_token":       "已配置 message_routes 或 routes，但 client_token 为空",
+		"route_unnamed":              "（未命名）",
+		"route_all_apps":             "全部应用",
+		"route_priority":             "，优先级 >= %d",
+		"route_title":                "，标题匹配 `%s`",
+		"route_contains":             "，包含 %s 之一",
+		"route_not_contains":         "，不包含 %s",
+		"route_all_recipients":       "全部接收者",
+		"route_account":              "（账号 %s）",
+		"route_jump":                 "，跳转到 %s",
+		"stream_error_title":         "Stream 连接断开",
+		"stream_error_message":       "连续 %d 次连接失败: %w",
+		"digest_title":               "%d 条新消息",
+		"digest_item":                "【%s】%s",
+		"footer_priority":            "\n优先级: %s (%d)",
+		"footer_time":                "\n时间: %s",
+		"priority_low":               "低",
+		"priority_medium":            "中",
+		"priority_high":              "高",
+		"errcode_hint_retryable":     "（%s，重试后仍失败）",
+		"errcode_hint_token":         "（%s，刷新 token 后仍失败）",
+		"errcode_hint_permanent":     "（%s，不会重试）",
+		"errcode_busy":               "系统繁忙",
+		"errcode_too_frequent":       "API 调用太频繁",
+		"errcode_token_invalid":      "access_token 无效",
+		"errcode_token_illegal":      "不合法的 access_token",
+		"errcode_token_expired":      "access_token 超时",
+		"errcode_bad_openid":         "不合法的 OpenID",
+		"errcode_bad_appid":          "不合法的 AppID",
+		"errcode_bad_template_id":    "template_id 不正确",
+		"errcode_bad_secret":         "无效的 AppSecret",
+		"errcode_ip_not_whitelisted": "调用接口的 IP 不在白名单中",
+		"errcode_not_following":      "接收者未关注公众号",
+		"errcode_subscribe_rejected": "用户拒绝接受订阅通知",
+		"errcode_daily_limit":        "接口调用超过每日限额",
+		"errcode_bad_template_data":  "模板参数不正确",
+		"errcode_unauthorized":       "接口未授权",
+		"errcode_rate_limited":       "接口调用超过频率限制",
+		"errcode_bad_webhook":        "webhook 地址无效",
+		"errcode_bot_not_in_group":   "群机器人不在群中",
+		"display_not_configured":     "插件尚未配置\n\n请先填写微信公众号的凭据。",
+		"display_title":              "微信模板消息推送",
+		"display_status":             "状态",
+		"display_config":             "配置",
+		"display_stats":              "统计",
+		"display_usage":              "使用说明",
+		"display_usage_forward":      "发送到 Gotify 的消息会自动转发到微信。",
+		"display_send_usage":         "### 通过 /send 发送（旧版 Webhook）",
+		"display_test_usage":         "### 测试连接\n点击发送测试消息：[发送测试消息](%s)",
+		"display_example_title":      "消息标题",
+		"display_example_body":       "消息内容",
+		"status_enabled":             "已启用",
+		"status_disabled":            "已停用",
+		"status_paused":              "已暂停（已达到 forward_limit %d，调用 POST /resume 恢复）",
+		"stats_totals":               "- **总发送数:** %d\n- **总失败数:** %d\n- **总过滤数:** %d\n- **最后发送:** %s\n",
+		"stats_never":                "无",
+		"stats_today":                "- **今日发送:** %d",
+		"stats_quota_warn":           "（%d 条时预警）",
+		"stats_quota_hard":           "（上限 %d 条）",
+		"stats_today_account":        "  - %s（%s）：%d\n",
+		"stats_last_error":           "- **最近错误:** %s%s\n",
+		"stats_error_repeat":         "（×%d，首次出现于 %s）",
+		"stats_errcodes":             "- **微信错误码:** 最近一小时 %s\n",
+		"canary_line":                "- **金丝雀检测:** %s\n",
+		"canary_pending":             "等待首次检测",
+		"canary_degraded":            "降级（%s: %s）",
+		"canary_ok":                  "正常（%s）",
+		"recipients_heading":         "\n### 接收者\n",
+		"recipient_line":             "- **%s:** %s%s\n",
+		"recipient_stats":            "（发送 %d，失败 %d",
+		"recipient_floor":            "，最低优先级 %d，过滤 %d",
+		"recipient_stats_end":        "）",
+		"recipient_legacy":           "\n### 接收者\n- **OpenID:** %s（发送 %d，失败 %d）\n",
+		"recipient_fallback":         "- **备用接收者:** %s（已启用 %d 次）\n",
+		"config_appid":               "- **AppID:** %s\n- **模板 ID:** %s\n",
+		"config_account":             "- **账号 %s:** %s（模板 %s）\n",
+		"config_workbot":             "- **推送方式:** 企业微信群机器人\n",
+		"stream_heading":             "\n## 消息流\n- **状态:** %s\n",
+		"stream_warning":             "- **警告:** %s\n",
+		"stream_not_started":         "未启动",
+		"stream_disconnected":        "未连接",
+		"stream_connected":           "已连接",
+		"stream_auth_failed":         "已停止（client_token 被拒绝）",
+		"stream_forwarded":           "- **已转发:** %d（过滤 %d）\n- **最近消息:** %s\n",
+		"stream_routes":              "- **路由:**\n",
+	},
+	languageEN: {
+		"notify_enabled":             "enabled",
+		"notify_disabled":            "disabled",
+		"paused_title":               "WeChat push paused",
+		"paused_message":             "Forwarded %d messages and reached forward_limit, call /resume to continue forwarding",
+		"canary_title":               "WeChat push self-check failed",
+		"canary_message":             "The self-check message to recipient %s failed, WeChat push may be unavailable:\n  - %s",
+		"stream_auth_title":          "WeChat push stream authentication failed",
+		"stream_auth_message":        "Gotify rejected client_token and the stream stopped reconnecting, check the config and call /reload or re-enable the plugin:\n  - %s",
+		"quota_title":                "WeChat push quota warning",
+		"quota_message":              "Official account %s has sent %d template messages today, reaching the warning threshold %d",
+		"quota_message_hard":         ", sending stops at %d",
+		"stream_problem_routes":      "client_token is set but no message_routes or routes are configured",
+		"stream_problem_token":       "message_routes or routes are configured but client_token is empty",
+		"route_unnamed":              "(unnamed)",
+		"route_all_apps":             "all apps",
+		"route_priority":             ", priority >= %d",
+		"route_title":                ", title ~ `%s`",
+		"route_contains":             ", contains any of %s",
+		"route_not_contains":         ", contains none of %s",
+		"route_all_recipients":       "all recipients",
+		"route_account":              " (account %s)",
+		"route_jump":                 ", jump to %s",
+		"stream_error_title":         "Stream disconnected",
+		"stream_error_message":       "%d consecutive connection failures: %w",
+		"digest_title":               "%d new messages",
+		"digest_item":                "[%s] %s",
+		"footer_priority":            "\nPriority: %s (%d)",
+		"footer_time":                "\nTime: %s",
+		"priority_low":               "low",
+		"priority_medium":            "medium",
+		"priority_high":              "high",
+		"errcode_hint_retryable":     " (%s, still failing after retries)",
+		"errcode_hint_token":         " (%s, still failing after refreshing the token)",
+		"errcode_hint_permanent":     " (%s, not retried)",
+		"errcode_busy":               "system busy",
+		"errcode_too_frequent":       "API called too frequently",
+		"errcode_token_invalid":      "invalid access_token",
+		"errcode_token_illegal":      "illegal access_token",
+		"errcode_token_expired":      "access_token expired",
+		"errcode_bad_openid":         "invalid OpenID",
+		"errcode_bad_appid":          "invalid AppID",
+		"errcode_bad_template_id":    "incorrect template_id",
+		"errcode_bad_secret":         "invalid AppSecret",
+		"errcode_ip_not_whitelisted": "caller IP is not in the whitelist",
+		"errcode_not_following":      "recipient does not follow the official account",
+		"errcode_subscribe_rejected": "user declined subscription messages",
+		"errcode_daily_limit":        "daily API call limit exceeded",
+		"errcode_bad_template_data":  "invalid template data",
+		"errcode_unauthorized":       "API not authorized",
+		"errcode_rate_limited":       "API rate limit exceeded",
+		"errcode_bad_webhook":        "invalid webhook URL",
+		"errcode_bot_not_in_group":   "bot is not in the group",
+		"display_not_configured":     "Plugin not configured\n\nPlease configure the plugin with your WeChat credentials.",
+		"display_title":              "WeChat Template Message Pusher",
+		"display_status":             "Status",
+		"display_config":             "Configuration",
+		"display_stats":              "Statistics",
+		"display_usage":              "Usage",
+		"display_usage_forward":      "Messages sent to Gotify will be automatically forwarded to WeChat.",
+		"display_send_usage":         "### Send via /send (Legacy Webhook)",
+		"display_test_usage":         "### Test Connection\nClick here to test: [Send Test Message](%s)",
+		"display_example_title":      "Message Title",
+		"display_example_body":       "Message Content",
+		"status_enabled":             "Enabled",
+		"status_disabled":            "Disabled",
+		"status_paused":              "Paused (forward_limit %d reached, POST /resume to continue)",
+		"stats_totals":               "- **Total Sent:** %d\n- **Total Failed:** %d\n- **Total Filtered:** %d\n- **Last Sent:** %s\n",
+		"stats_never":                "N/A",
+		"stats_today":                "- **Sent Today:** %d",
+		"stats_quota_warn":           " (warn at %d)",
+		"stats_quota_hard":           " (hard cap %d)",
+		"stats_today_account":        "  - %s (%s): %d\n",
+		"stats_last_error":           "- **Last Error:** %s%s\n",
+		"stats_error_repeat":         " (×%d since %s)",
+		"stats_errcodes":             "- **WeChat Errcodes:** %s in last hour\n",
+		"canary_line":                "- **Canary:** %s\n",
+		"canary_pending":             "Pending",
+		"canary_degraded":            "Degraded (%s: %s)",
+		"canary_ok":                  "OK (%s)",
+		"recipients_heading":         "\n### Recipients\n",
+		"recipient_line":             "- **%s:** %s%s\n",
+		"recipient_stats":            " (sent %d, failed %d",
+		"recipient_floor":            ", min priority %d, filtered %d",
+		"recipient_stats_end":        ")",
+		"recipient_legacy":           "\n### Recipient\n- **OpenID:** %s (sent %d, failed %d)\n",
+		"recipient_fallback":         "- **Fallback:** %s (escalated %d times)\n",
+		"config_appid":               "- **AppID:** %s\n- **Template ID:** %s\n",
+		"config_account":             "- **Account %s:** %s (template %s)\n",
+		"config_workbot":             "- **Backend:** WeChat Work bot\n",
+		"stream_heading":             "\n## Message Stream\n- **Status:** %s\n",
+		"stream_warning":             "- **Warning:** %s\n",
+		"stream_not_started":         "Not started",
+		"stream_disconnected":        "Disconnected",
+		"stream_connected":           "Connected",
+		"stream_auth_failed":         "Stopped (client_token rejected)",
+		"stream_forwarded":           "- **Forwarded:** %d (filtered %d)\n- **Last Message:** %s\n",
+		"stream_routes":              "- **Routes:**\n",
+	},
+}
+
+// translate 返回 lang 下 key 对应的文案；未知语言或缺失的文案回退到默认语言
+func translate(lang, key string, args ...interface{}) string {
+	text, ok := messageCatalogs[lang][key]
+	if !ok {
+		text = messageCatalogs[defaultLanguage][key]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// text 按配置的 language 返回文案
+func (c *Config) text(key string, args ...interface{}) string {
+	return translate(c.Language, key, args...)
+}
+
+// SetLanguage 设置插件通知使用的语言
+func (m *MessageManager) SetLanguage(lang string) {
+	if m == nil {
+		return
+	}
+	m.language.Store(lang)
+}
+
+// lang 返回插件通知当前使用的语言，未设置时为默认语言
+func (m *MessageManager) lang() string {
+	if lang, ok := m.language.Load().(string); ok && lang != "" {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// text 按当前通知语言返回文案
+func (m *MessageManager) text(key string, args ...interface{}) string {
+	return translate(m.lang(), key, args...)
+}
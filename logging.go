@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// 日志级别
+const (
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+// logFields 结构化日志的附加字段，如 recipient（已脱敏）、msgid、errcode
+type logFields map[string]interface{}
+
+// sensitiveQueryParams 请求地址中携带密钥的查询参数：微信 access_token、群机器人 key、Gotify token
+var sensitiveQueryParams = []string{"access_token", "key", "secret", "token"}
+
+// redactURL 将地址中的密钥类查询参数替换为 ****，解析失败时整体隐藏
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "****"
+	}
+	q := u.Query()
+	redacted := false
+	for _, name := range sensitiveQueryParams {
+		if q.Has(name) {
+			q.Set(name, "****")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// redactURLError 脱敏 *url.Error 中包含的请求地址，避免 access_token 等密钥出现在日志或返回的错误中
+func redactURLError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return &url.Error{Op: ue.Op, URL: redactURL(ue.URL), Err: ue.Err}
+	}
+	return err
+}
+
+// sendErrorFields 发送失败日志的公共字段，微信返回错误码时附带 errcode
+func sendErrorFields(target string, err error) logFields {
+	fields := logFields{"recipient": target, "error": err}
+	var we *WeChatError
+	if errors.As(err, &we) {
+		fields["errcode"] = we.Code
+	}
+	return fields
+}
+
+// logEvent 输出一条日志：默认为人类可读文本，开启 json_logs 时输出一行 JSON
+// JSON 中包含 time、level、event、msg 以及 fields 中的字段，error 类型的字段值会转换为字符串
+func (p *WeChatPlugin) logEvent(level, event string, fields logFields, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !p.jsonLogs.Load() {
+		log.Printf("[WeChat Plugin] %s", msg)
+		return
+	}
+
+	entry := make(map[string]interface{}, len(fields)+5)
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["event"] = event
+	entry["msg"] = msg
+	entry["plugin"] = "wechat"
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[WeChat Plugin] %s (failed to encode log entry: %v)", msg, err)
+		return
+	}
+	log.Writer().Write(append(data, '\n'))
+}
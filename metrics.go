@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// metricsContentType Prometheus 文本格式的 Content-Type
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// escapeLabel 转义 Prometheus 标签值
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// boolGauge 将布尔值转换为 0/1
+func boolGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeMetric 写入一个不带标签的指标
+func writeMetric(w io.Writer, name, typ, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+}
+
+// writeRecipientMetric 写入一个按接收者名称打标签的计数器
+func writeRecipientMetric(w io.Writer, name, help string, recipients []string, value func(string) int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, r := range recipients {
+		fmt.Fprintf(w, "%s{recipient=\"%s\"} %d\n", name, escapeLabel(r), value(r))
+	}
+}
+
+// writeMetrics 以 Prometheus 文本格式输出插件指标
+func (p *WeChatPlugin) writeMetrics(w io.Writer) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	sent, failed, _, _ := p.msgMgr.Stats()
+	byRecipient := p.msgMgr.RecipientStats()
+	names := make([]string, 0, len(byRecipient))
+	for name := range byRecipient {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeMetric(w, "wechat_plugin_enabled", "gauge", "Whether the plugin is enabled.", boolGauge(p.enabled))
+	writeMetric(w, "wechat_messages_sent_total", "counter", "Total WeChat messages sent successfully.", sent)
+	writeMetric(w, "wechat_messages_failed_total", "counter", "Total WeChat messages that failed to send.", failed)
+	writeMetric(w, "wechat_messages_escalated_total", "counter", "Messages escalated to fallback_recipients after all recipients failed.", p.msgMgr.Escalations())
+
+	writeRecipientMetric(w, "wechat_recipient_messages_sent_total", "WeChat messages sent successfully per recipient.",
+		names, func(name string) int64 { return byRecipient[name].Sent })
+	writeRecipientMetric(w, "wechat_recipient_messages_failed_total", "WeChat messages that failed to send per recipient.",
+		names, func(name string) int64 { return byRecipient[name].Failed })
+	writeRecipientMetric(w, "wechat_messages_filtered_total", "Messages skipped by recipient min_priority.",
+		names, func(name string) int64 { return byRecipient[name].Filtered })
+
+	if cfg := p.configSnapshot(); cfg != nil {
+		sentToday := p.sentToday(cfg)
+		fmt.Fprint(w, "# HELP wechat_messages_sent_today WeChat messages sent today per account.\n# TYPE wechat_messages_sent_today gauge\n")
+		for _, a := range cfg.allAccounts() {
+			fmt.Fprintf(w, "wechat_messages_sent_today{account=\"%s\"} %d\n", escapeLabel(a.Name), sentToday[a.Name].Count)
+		}
+	}
+
+	connected := p.stream != nil && p.stream.Connected()
+	writeMetric(w, "wechat_stream_connected", "gauge", "Whether the Gotify stream is connected.", boolGauge(connected))
+	if p.stream != nil {
+		writeMetric(w, "wechat_stream_reconnects_total", "counter", "Total Gotify stream reconnects.", p.stream.Reconnects())
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// 可自定义文案的插件通知类型
+const (
+	notifyStatus   = "status"   // 插件启用/停用
+	notifyDelivery = "delivery" // 投递成功
+	notifyError    = "error"    // 推送失败
+)
+
+// statusNotifyData 状态变更通知模板可引用的字段
+type statusNotifyData struct {
+	User    string
+	Status  string // 启用 或 停用，随 language 变化
+	Enabled bool
+}
+
+// deliveryNotifyData 投递成功通知模板可引用的字段
+type deliveryNotifyData struct {
+	Title   string
+	Success int
+	Total   int
+}
+
+// errorNotifyData 推送失败通知模板可引用的字段
+type errorNotifyData struct {
+	Title  string
+	Failed int
+	Total  int
+	Errors []string // 每个失败接收者的错误，含错误码提示
+}
+
+// notifyTemplate 一类通知的标题和正文模板
+type notifyTemplate struct {
+	title   *template.Template
+	message *template.Template
+}
+
+// notifyTemplates 按通知类型的模板
+type notifyTemplates map[string]notifyTemplate
+
+// defaultNotifyTexts 各语言下各类通知默认的标题和正文模板
+var defaultNotifyTexts = map[string]map[string][2]string{
+	languageZH: {
+		notifyStatus:   {"微信推送插件状态变更", "用户 {{.User}} 的微信推送插件已{{.Status}}"},
+		notifyDelivery: {"微信推送成功", "消息「{{.Title}}」已成功推送至 {{.Success}}/{{.Total}} 个接收者"},
+		notifyError:    {"微信推送失败", "消息「{{.Title}}」推送失败 {{.Failed}}/{{.Total}}:{{range .Errors}}\n  - {{.}}{{end}}"},
+	},
+	languageEN: {
+		notifyStatus:   {"WeChat push plugin status changed", "The WeChat push plugin of user {{.User}} has been {{.Status}}"},
+		notifyDelivery: {"WeChat push succeeded", "Message \"{{.Title}}\" was delivered to {{.Success}}/{{.Total}} recipients"},
+		notifyError:    {"WeChat push failed", "Message \"{{.Title}}\" failed for {{.Failed}}/{{.Total}} recipients:{{range .Errors}}\n  - {{.}}{{end}}"},
+	},
+}
+
+// notifySampleData 校验模板时使用的示例数据，确保模板引用的字段存在
+var notifySampleData = map[string]interface{}{
+	notifyStatus:   statusNotifyData{User: "admin", Status: "启用", Enabled: true},
+	notifyDelivery: deliveryNotifyData{Title: "title", Success: 1, Total: 1},
+	notifyError:    errorNotifyData{Title: "title", Failed: 1, Total: 1, Errors: []string{"error"}},
+}
+
+// defaultNotifyTemplates 各语言默认文案编译后的模板，自定义模板渲染失败时回退使用
+var defaultNotifyTemplates = func() map[string]notifyTemplates {
+	templates := make(map[string]notifyTemplates, len(defaultNotifyTexts))
+	for lang, texts := range defaultNotifyTexts {
+		templates[lang] = mustNotifyTemplates(texts)
+	}
+	return templates
+}()
+
+// mustNotifyTemplates 编译内置的通知模板，出错时 panic
+func mustNotifyTemplates(texts map[string][2]string) notifyTemplates {
+	templates := make(notifyTemplates, len(texts))
+	for kind, text := range texts {
+		templates[kind] = notifyTemplate{
+			title:   template.Must(template.New(kind + "_title").Parse(text[0])),
+			message: template.Must(template.New(kind + "_message").Parse(text[1])),
+		}
+	}
+	return templates
+}
+
+// parseNotifyTemplate 解析一个自定义通知模板并用示例数据试渲染，为空时返回 fallback
+func parseNotifyTemplate(key, text string, fallback *template.Template, sample interface{}) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return fallback, nil
+	}
+	tmpl, err := template.New(key).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return tmpl, nil
+}
+
+// compileNotifyTemplates 按配置编译通知模板，未配置的部分使用 language 对应的默认文案
+func (c *Config) compileNotifyTemplates() (notifyTemplates, error) {
+	custom := map[string][2]string{
+		notifyStatus:   {c.StatusNotifyTitle, c.StatusNotifyMessage},
+		notifyDelivery: {c.DeliveryNotifyTitle, c.DeliveryNotifyMessage},
+		notifyError:    {c.ErrorNotifyTitle, c.ErrorNotifyMessage},
+	}
+	templates := make(notifyTemplates, len(custom))
+	for kind, text := range custom {
+		def := defaultNotifyTemplates[c.Language][kind]
+		title, err := parseNotifyTemplate(kind+"_notify_title", text[0], def.title, notifySampleData[kind])
+		if err != nil {
+			return nil, err
+		}
+		message, err := parseNotifyTemplate(kind+"_notify_message", text[1], def.message, notifySampleData[kind])
+		if err != nil {
+			return nil, err
+		}
+		templates[kind] = notifyTemplate{title: title, message: message}
+	}
+	return templates, nil
+}
+
+// executeNotify 渲染模板，失败时使用 fallback 渲染
+func executeNotify(tmpl, fallback *template.Template, data interface{}) string {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err == nil {
+		return b.String()
+	}
+	b.Reset()
+	_ = fallback.Execute(&b, data)
+	return b.String()
+}
+
+// SetNotifyTemplates 设置通知模板，nil 表示使用默认文案
+func (m *MessageManager) SetNotifyTemplates(templates notifyTemplates) {
+	if m == nil {
+		return
+	}
+	m.templates.Store(&templates)
+}
+
+// renderNotify 按当前模板渲染通知的标题和正文
+func (m *MessageManager) renderNotify(kind string, data interface{}) (title, message string) {
+	def := defaultNotifyTemplates[m.lang()][kind]
+	t := def
+	if templates := m.templates.Load(); templates != nil {
+		if custom, ok := (*templates)[kind]; ok {
+			t = custom
+		}
+	}
+	return executeNotify(t.title, def.title, data), executeNotify(t.message, def.message, data)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// dailyQuota 按自然日统计各微信 AppID 的发送数，跨日（按配置时区）自动清零
+type dailyQuota struct {
+	mu     sync.Mutex
+	day    string
+	counts map[string]int64
+	warned map[string]bool
+	now    func() time.Time // 为 nil 时使用 time.Now，测试中替换以模拟跨日
+}
+
+// accountQuota 单个账号的当日发送数，AppID 已脱敏
+type accountQuota struct {
+	AppID string `json:"appid"`
+	Count int64  `json:"count"`
+}
+
+// clock 返回当前时间，调用方需持有 mu
+func (q *dailyQuota) clock() time.Time {
+	if q.now != nil {
+		return q.now()
+	}
+	return time.Now()
+}
+
+// rollover 跨日时清零计数，调用方需持有 mu
+func (q *dailyQuota) rollover(now time.Time, loc *time.Location) {
+	if loc == nil {
+		loc = time.Local
+	}
+	day := now.In(loc).Format("2006-01-02")
+	if day != q.day || q.counts == nil {
+		q.day = day
+		q.counts = make(map[string]int64)
+		q.warned = make(map[string]bool)
+	}
+}
+
+// check 当日发送数已达到 hard 上限时返回错误，hard <= 0 表示不限制
+func (q *dailyQuota) check(appID string, hard int64, loc *time.Location) error {
+	if hard <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(q.clock(), loc)
+	if q.counts[appID] >= hard {
+		return fmt.Errorf("daily quota reached: %d/%d sent today", q.counts[appID], hard)
+	}
+	return nil
+}
+
+// record 记录一次成功发送，首次达到 warn 阈值时返回 true
+func (q *dailyQuota) record(appID string, warn int64, loc *time.Location) (count int64, crossedWarn bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(q.clock(), loc)
+	q.counts[appID]++
+	count = q.counts[appID]
+	if warn > 0 && count >= warn && !q.warned[appID] {
+		q.warned[appID] = true
+		crossedWarn = true
+	}
+	return count, crossedWarn
+}
+
+// today 返回当日发送数
+func (q *dailyQuota) today(appID string, loc *time.Location) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(q.clock(), loc)
+	return q.counts[appID]
+}
+
+// sentToday 按账号名称返回 cfg 中所有账号的当日发送数
+func (p *WeChatPlugin) sentToday(cfg *Config) map[string]accountQuota {
+	out := make(map[string]accountQuota, len(cfg.Accounts)+1)
+	for _, a := range cfg.allAccounts() {
+		out[a.Name] = accountQuota{AppID: maskString(a.AppID), Count: p.quota.today(a.AppID, cfg.location)}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotify/plugin-api"
+)
+
+// TestDailyQuotaRolloverInTimezone 计数按配置时区的零点清零，而不是按 UTC
+func TestDailyQuotaRolloverInTimezone(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	now := time.Date(2026, 1, 1, 15, 59, 0, 0, time.UTC) // 北京时间 23:59
+	clock := func() time.Time { return now }
+	q := &dailyQuota{now: clock}
+	utc := &dailyQuota{now: clock}
+
+	for i := 0; i < 2; i++ {
+		q.record("wx1", 2, cst)
+		utc.record("wx1", 2, time.UTC)
+	}
+	if got := q.today("wx1", cst); got != 2 {
+		t.Fatalf("today before midnight = %d, want 2", got)
+	}
+
+	now = now.Add(time.Minute) // 北京时间次日 00:00，UTC 仍是当天
+	if got := q.today("wx1", cst); got != 0 {
+		t.Errorf("today after midnight in CST = %d, want 0", got)
+	}
+	if got := utc.today("wx1", time.UTC); got != 2 {
+		t.Errorf("today in UTC = %d, want 2 (no rollover yet)", got)
+	}
+	if err := q.check("wx1", 2, cst); err != nil {
+		t.Errorf("check after rollover: %v", err)
+	}
+	if _, crossed := q.record("wx1", 1, cst); !crossed {
+		t.Error("warning did not fire again on the new day")
+	}
+}
+
+// TestQuotaWarningFiresOnce 达到 daily_quota_warn 后只预警一次，各账号分别计算
+func TestQuotaWarningFiresOnce(t *testing.T) {
+	h := &fakeMessageHandler{}
+	p := NewGotifyPluginInstance(plugin.UserContext{Name: "tester"}).(*WeChatPlugin)
+	p.SetMessageHandler(h)
+	c := testConfig()
+	c.DailyQuotaWarn = 2
+	if err := p.ValidateAndSetConfig(c); err != nil {
+		t.Fatalf("ValidateAndSetConfig: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		p.recordDailySend("wx1")
+	}
+	p.recordDailySend("wx2")
+	p.recordDailySend("wx2")
+
+	title := p.configSnapshot().text("quota_title")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	warnings := 0
+	for _, m := range h.msgs {
+		if m.Title == title {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("got %d quota warnings, want one per account (2)", warnings)
+	}
+}
+
+// TestSentTodayPerAccount sentToday 按账号名称列出所有账号，AppID 已脱敏
+func TestSentTodayPerAccount(t *testing.T) {
+	p := NewGotifyPluginInstance(plugin.UserContext{Name: "tester"}).(*WeChatPlugin)
+	c := testConfig()
+	c.Accounts = []Account{{
+		Name:       "ops",
+		AppID:      "wxfedcba0987654321",
+		AppSecret:  "fedcba9876543210fedcba9876543210",
+		TemplateID: "tmpl_ops_template",
+	}}
+	if err := p.ValidateAndSetConfig(c); err != nil {
+		t.Fatalf("ValidateAndSetConfig: %v", err)
+	}
+	p.recordDailySend("wxfedcba0987654321")
+
+	got := p.sentToday(p.configSnapshot())
+	want := map[string]accountQuota{
+		defaultAccountName: {AppID: maskString("wx1234567890abcdef"), Count: 0},
+		"ops":              {AppID: maskString("wxfedcba0987654321"), Count: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sentToday = %v, want %v", got, want)
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("sentToday[%q] = %+v, want %+v", name, got[name], w)
+		}
+	}
+}
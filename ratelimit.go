@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sendLimiter 限制微信 API 的并发调用数和调用间隔，超出限制时排队等待而不是丢弃
+type sendLimiter struct {
+	sem      chan struct{} // 为 nil 时不限制并发
+	interval time.Duration // 相邻两次调用的最小间隔，0 表示不限制
+
+	mu   sync.Mutex
+	next time.Time // 下一次允许调用的时间
+
+	waiting atomic.Int64 // 正在等待并发名额或调用间隔的调用数
+}
+
+// newSendLimiter 创建发送限流器，maxConcurrency 为 0 表示不限制并发
+func newSendLimiter(maxConcurrency int, interval time.Duration) *sendLimiter {
+	l := &sendLimiter{interval: interval}
+	if maxConcurrency > 0 {
+		l.sem = make(chan struct{}, maxConcurrency)
+	}
+	return l
+}
+
+// acquire 阻塞直到允许发起一次调用，返回的函数用于释放并发名额
+// ctx 被取消时放弃排队，归还已占用的并发名额和调用时间并返回 ctx.Err()
+func (l *sendLimiter) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		if l.sem != nil {
+			<-l.sem
+		}
+	}
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next
+		if start.Before(now) {
+			start = now
+		}
+		l.next = start.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait := start.Sub(now); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				// 之后没有其他调用排队时退回预约的时间，避免取消的调用拖慢后续发送
+				l.mu.Lock()
+				if l.next.Equal(start.Add(l.interval)) {
+					l.next = start
+				}
+				l.mu.Unlock()
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
+// waiters 返回正在排队等待的调用数
+func (l *sendLimiter) waiters() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.waiting.Load()
+}
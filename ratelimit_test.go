@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAcquireCancelledWhileQueued 排队等待并发名额时取消 ctx 应立即返回，且不占用名额
+func TestAcquireCancelledWhileQueued(t *testing.T) {
+	l := newSendLimiter(1, 0)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("queued acquire = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued acquire was not unblocked by cancel")
+	}
+
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != nil {
+		t.Errorf("acquire after release: %v, the cancelled call leaked a slot", err)
+	}
+}
+
+// TestAcquireCancelledWhileWaitingInterval 等待 min_send_interval 时取消 ctx 应立即返回，并退回预约的时间
+func TestAcquireCancelledWhileWaitingInterval(t *testing.T) {
+	l := newSendLimiter(1, time.Hour)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	release()
+	l.mu.Lock()
+	next := l.next
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("acquire returned after %v", elapsed)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.next.Equal(next) {
+		t.Errorf("next = %v, want the cancelled reservation returned (%v)", l.next, next)
+	}
+	if len(l.sem) != 0 {
+		t.Errorf("%d slots still held after cancel", len(l.sem))
+	}
+}
+
+// TestLimiterWaiters 排队中的调用计入 waiters，取得名额或放弃后移除
+func TestLimiterWaiters(t *testing.T) {
+	l := newSendLimiter(1, 0)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if n := l.waiters(); n != 0 {
+		t.Errorf("waiters with a held slot = %d, want 0", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_, _ = l.acquire(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for l.waiters() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiters = %d, want 1", l.waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	release()
+	if n := l.waiters(); n != 0 {
+		t.Errorf("waiters after cancel = %d, want 0", n)
+	}
+}
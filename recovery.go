@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// recoveryPageSize 补发时每次请求的消息数
+	recoveryPageSize = 100
+	// recoveryMaxMessages 单次补发的消息数上限，避免长时间断线后刷屏
+	recoveryMaxMessages = 500
+)
+
+// gotifyPagedMessages 对应 Gotify API 的 PagedMessages 模型
+type gotifyPagedMessages struct {
+	Messages []GotifyMessage `json:"messages"`
+	Paging   struct {
+		Since int64 `json:"since"`
+	} `json:"paging"`
+}
+
+// observe 记录已收到的最大消息 ID
+func (s *StreamListener) observe(id int64) {
+	for {
+		cur := s.lastID.Load()
+		if id <= cur || s.lastID.CompareAndSwap(cur, id) {
+			return
+		}
+	}
+}
+
+// recoverMissed 通过 REST API 补发断线期间错过的消息（ID 大于 after 的消息）
+// after 为 0 时仅记录当前最新的消息 ID，不补发历史消息；ctx 被取消时停止补发
+func (s *StreamListener) recoverMissed(ctx context.Context, after int64) {
+	if after == 0 {
+		page, err := s.fetchMessages(ctx, 0, 1)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.plugin.logEvent(levelWarn, "recovery_failed", logFields{"error": err}, "Failed to fetch latest message id: %v", err)
+			return
+		}
+		if len(page.Messages) > 0 {
+			s.observe(page.Messages[0].ID)
+		}
+		return
+	}
+
+	var missed []GotifyMessage
+	since := int64(0)
+	truncated := false
+collect:
+	for {
+		page, err := s.fetchMessages(ctx, since, recoveryPageSize)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.plugin.logEvent(levelWarn, "recovery_failed", logFields{"error": err}, "Failed to recover missed messages: %v", err)
+			return
+		}
+		// Gotify 按 ID 倒序返回，遇到已见过的消息即停止
+		for _, msg := range page.Messages {
+			if msg.ID <= after {
+				break collect
+			}
+			if len(missed) >= recoveryMaxMessages {
+				truncated = true
+				break collect
+			}
+			missed = append(missed, msg)
+		}
+		if page.Paging.Since == 0 || len(page.Messages) < recoveryPageSize {
+			break
+		}
+		since = page.Paging.Since
+	}
+
+	if len(missed) == 0 {
+		return
+	}
+	if truncated {
+		s.plugin.logEvent(levelWarn, "recovery_truncated", logFields{"limit": recoveryMaxMessages},
+			"More than %d messages missed, only the latest %d are recovered", recoveryMaxMessages, recoveryMaxMessages)
+	}
+	s.plugin.logEvent(levelInfo, "recovery_started", logFields{"count": len(missed), "after_id": after},
+		"Recovering %d missed messages after id %d", len(missed), after)
+
+	// 按时间顺序（从旧到新）补发
+	for i := len(missed) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return
+		}
+		s.handle(missed[i])
+	}
+}
+
+// fetchMessages 请求 GET /message，since 为 0 时从最新的消息开始
+func (s *StreamListener) fetchMessages(ctx context.Context, since int64, limit int) (*gotifyPagedMessages, error) {
+	return fetchGotifyMessages(ctx, s.client, s.plugin.configSnapshot(), since, limit)
+}
+
+// fetchGotifyMessage 按 ID 获取单条 Gotify 消息，消息不存在时返回 errGotifyMessageNotFound
+// Gotify 没有按 ID 查询单条消息的接口，通过 since=id+1&limit=1 取 ID 不大于 id 的最新一条再比对
+func fetchGotifyMessage(ctx context.Context, client *http.Client, c *Config, id int64) (GotifyMessage, error) {
+	page, err := fetchGotifyMessages(ctx, client, c, id+1, 1)
+	if err != nil {
+		return GotifyMessage{}, err
+	}
+	if len(page.Messages) == 0 || page.Messages[0].ID != id {
+		return GotifyMessage{}, errGotifyMessageNotFound
+	}
+	return page.Messages[0], nil
+}
+
+// errGotifyMessageNotFound Gotify 中不存在指定 ID 的消息
+var errGotifyMessageNotFound = errors.New("gotify message not found")
+
+// fetchGotifyMessages 使用 client_token 请求 GET /message，since 为 0 时从最新的消息开始
+func fetchGotifyMessages(ctx context.Context, client *http.Client, c *Config, since int64, limit int) (*gotifyPagedMessages, error) {
+	base, err := gotifyBaseURL(c)
+	if err != nil {
+		return nil, err
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/message"
+	q := base.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	if since > 0 {
+		q.Set("since", strconv.FormatInt(since, 10))
+	}
+	base.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Gotify-Key", c.ClientToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var page gotifyPagedMessages
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &page, nil
+}
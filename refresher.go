@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 后台刷新 access_token 的等待时间：两次检查的最长 / 最短间隔，以及获取失败时的重试退避
+const (
+	tokenRefreshMaxWait      = time.Hour
+	tokenRefreshMinWait      = 30 * time.Second
+	tokenRefreshRetryInitial = 5 * time.Second
+	tokenRefreshRetryMax     = 5 * time.Minute
+)
+
+// runTokenRefresher 在 access_token 进入 token_refresh_margin 时提前获取新 token，
+// 使发送消息时无需等待获取 token；获取失败时按指数退避重试
+func (p *WeChatPlugin) runTokenRefresher(stop <-chan struct{}) {
+	backoff := tokenRefreshRetryInitial
+	for {
+		wait, err := p.refreshTokens()
+		if err != nil {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			p.logEvent(levelWarn, "token_refresh_failed", logFields{"error": err, "backoff": backoff.String()},
+				"Background token refresh failed: %v, retrying in %v", err, backoff)
+			wait = min(wait, backoff)
+			backoff = min(backoff*2, tokenRefreshRetryMax)
+		} else {
+			backoff = tokenRefreshRetryInitial
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// syncTokenRefresherLocked 按启用状态和 backend 启动或停止后台刷新 token：
+// 已启用且使用公众号时运行，work_bot 不需要 access_token；调用方需持有 p.mu
+func (p *WeChatPlugin) syncTokenRefresherLocked() {
+	want := p.enabled && p.config != nil && p.config.Backend != backendWorkBot
+	if !want {
+		p.stopTokenRefresherLocked()
+		return
+	}
+	if p.refreshStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	p.refreshStop = stop
+	p.bgWG.Add(1)
+	go func() {
+		defer p.bgWG.Done()
+		p.runTokenRefresher(stop)
+	}()
+}
+
+// stopTokenRefresherLocked 通知后台刷新 token 停止，不等待正在进行的获取完成（由 bgWG 跟踪）；调用方需持有 p.mu
+func (p *WeChatPlugin) stopTokenRefresherLocked() {
+	if p.refreshStop != nil {
+		close(p.refreshStop)
+		p.refreshStop = nil
+	}
+}
+
+// refreshTokens 为所有账号获取已进入刷新时间的 token，返回距下一个 token 需要刷新的时间
+func (p *WeChatPlugin) refreshTokens() (time.Duration, error) {
+	cfg := p.configSnapshot()
+	if cfg.Backend == backendWorkBot {
+		return tokenRefreshMaxWait, nil
+	}
+	accounts := cfg.allAccounts()
+
+	ctx := p.runContext()
+	next := tokenRefreshMaxWait
+	var errs []error
+	for _, acct := range accounts {
+		// 普通模式下 stable_token 在有效期内总是返回同一个 token，已进入刷新时间的 token 需强制签发新 token
+		if _, err := p.getAccessToken(ctx, acct, p.tokenDue(acct.AppID, cfg.TokenRefreshMargin)); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", acct.Name, err))
+			continue
+		}
+
+		cache := p.tokenCacheFor(acct.AppID)
+		cache.mu.RLock()
+		wait := time.Until(cache.ExpiresAt.Add(-cfg.TokenRefreshMargin))
+		cache.mu.RUnlock()
+		next = min(next, max(wait, tokenRefreshMinWait))
+	}
+	return next, errors.Join(errs...)
+}
+
+// tokenDue 返回 appID 缓存的 token 是否已进入 margin 内的刷新时间；没有缓存时返回 false
+func (p *WeChatPlugin) tokenDue(appID string, margin time.Duration) bool {
+	cache := p.tokenCacheFor(appID)
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.Token != "" && !time.Now().Before(cache.ExpiresAt.Add(-margin))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRefreshTokensForcesRenewal 普通模式返回的 token 已进入刷新时间时，下一轮应强制签发新 token
+func TestRefreshTokensForcesRenewal(t *testing.T) {
+	mock := &mockWeChat{token: func(forced bool) AccessTokenResponse {
+		if forced {
+			return AccessTokenResponse{AccessToken: "fresh", ExpiresIn: 7200}
+		}
+		// stable_token 普通模式：返回剩余有效期已不足 token_refresh_margin 的同一个 token
+		return AccessTokenResponse{AccessToken: "stale", ExpiresIn: 60}
+	}}
+	p := newTestPlugin(t, mock, testConfig())
+
+	wait, err := p.refreshTokens()
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if wait != tokenRefreshMinWait {
+		t.Errorf("wait after stale token = %v, want %v", wait, tokenRefreshMinWait)
+	}
+
+	wait, err = p.refreshTokens()
+	if err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	if got := mock.forcedTokens.Load(); got != 1 {
+		t.Errorf("forced refreshes = %d, want 1", got)
+	}
+	cache := p.tokenCacheFor(testConfig().AppID)
+	if cache.Token != "fresh" {
+		t.Errorf("cached token = %q, want fresh", cache.Token)
+	}
+	if wait < 30*time.Minute {
+		t.Errorf("wait after renewal = %v, want the next refresh to be far away", wait)
+	}
+
+	// 新 token 未进入刷新时间，不应再次强制刷新
+	if _, err := p.refreshTokens(); err != nil {
+		t.Fatalf("third refresh: %v", err)
+	}
+	if got := mock.forcedTokens.Load(); got != 1 {
+		t.Errorf("forced refreshes after renewal = %d, want 1", got)
+	}
+}
+
+// TestRefresherFollowsBackendSwitch 运行中切换 backend 时随之停止或启动后台刷新 token
+func TestRefresherFollowsBackendSwitch(t *testing.T) {
+	mock := &mockWeChat{}
+	p := newTestPlugin(t, mock, testConfig())
+	if err := p.Enable(); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	defer p.Disable()
+
+	running := func() bool {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		return p.refreshStop != nil
+	}
+	if !running() {
+		t.Fatal("refresher not running after Enable")
+	}
+
+	bot := (&WeChatPlugin{}).DefaultConfig().(*Config)
+	bot.Backend = backendWorkBot
+	bot.Recipients = []Recipient{{Name: "ops", WebhookURL: "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=test"}}
+	if err := p.ValidateAndSetConfig(bot); err != nil {
+		t.Fatalf("switch to work_bot: %v", err)
+	}
+	if running() {
+		t.Error("refresher still running after switching to work_bot")
+	}
+
+	calls := mock.tokenCalls.Load()
+	if err := p.ValidateAndSetConfig(testConfig()); err != nil {
+		t.Fatalf("switch back to official_account: %v", err)
+	}
+	if !running() {
+		t.Fatal("refresher not restarted after switching back to official_account")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for mock.tokenCalls.Load() == calls {
+		if time.Now().After(deadline) {
+			t.Fatal("restarted refresher did not fetch a token")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
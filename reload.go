@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// streamSettingKeys 需要重建消息流连接才能生效的配置项，其他配置（接收者、路由等）在转发时实时读取
+var streamSettingKeys = []string{
+	"gotify_url", "client_token", "stream_token_in_query", "ping_interval", "dedup_window",
+	"stream_handshake_timeout", "skip_tls_verify",
+	"reconnect_initial_backoff", "reconnect_max_backoff", "http_timeout",
+	"digest_window", "digest_max_count",
+}
+
+// reloadResult /reload 的结果
+type reloadResult struct {
+	Changed []string `json:"changed"` // 相比上次生效的配置发生变化的配置项
+	Stream  string   `json:"stream"`  // 消息流的处理：unchanged、started、stopped、restarted、not_running
+}
+
+// startStreamLocked 按当前配置启动消息流监听，配置不完整时记录警告；调用方需持有 p.mu
+func (p *WeChatPlugin) startStreamLocked() {
+	if routeCount := len(p.config.MessageRoutes) + len(p.config.Routes); p.config.ClientToken != "" && routeCount > 0 {
+		p.stream = NewStreamListener(p)
+		go p.stream.Start()
+		p.logEvent(levelInfo, "stream_started", logFields{"routes": routeCount}, "Stream listener started with %d routes", routeCount)
+	} else if problem := p.config.streamConfigProblem(languageEN); problem != "" {
+		p.logEvent(levelWarn, "stream_not_started", nil, "Stream listener not started: %s", problem)
+	}
+}
+
+// reload 重新校验当前配置并使其生效：路由随配置重建，消息流仅在连接相关配置变化时重连，
+// 不再需要时停止、新增时启动；统计和 token 缓存保持不变
+func (p *WeChatPlugin) reload() (reloadResult, error) {
+	res := reloadResult{Changed: []string{}, Stream: "not_running"}
+
+	p.mu.RLock()
+	if p.config == nil {
+		p.mu.RUnlock()
+		return res, fmt.Errorf("plugin not configured")
+	}
+	cfg, err := cloneConfig(p.config)
+	prev := p.appliedConfig
+	if prev == nil {
+		prev = p.config
+	}
+	p.mu.RUnlock()
+	if err != nil {
+		return res, err
+	}
+
+	if err := p.ValidateAndSetConfig(cfg); err != nil {
+		return res, err
+	}
+	res.Changed = configChanges(prev, cfg)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.appliedConfig = p.config
+	if !p.enabled {
+		return res, nil
+	}
+	if prev.MaxConcurrency != p.config.MaxConcurrency || prev.MinSendInterval != p.config.MinSendInterval {
+		p.limiter.Store(newSendLimiter(p.config.MaxConcurrency, p.config.MinSendInterval))
+	}
+
+	streamChanged := false
+	for _, key := range res.Changed {
+		for _, k := range streamSettingKeys {
+			if key == k {
+				streamChanged = true
+			}
+		}
+	}
+
+	// 因 client_token 被拒绝而停止重连的消息流也重新连接
+	wasRunning := p.stream != nil
+	if wasRunning && p.stream.AuthFailed() {
+		streamChanged = true
+	}
+	if wasRunning && (streamChanged || p.config.streamConfigProblem(languageEN) != "" || !hasStreamRoutes(p.config)) {
+		p.stream.Stop()
+		p.stream = nil
+	}
+	if p.stream == nil {
+		p.startStreamLocked()
+	}
+
+	switch running := p.stream != nil; {
+	case wasRunning && running && streamChanged:
+		res.Stream = "restarted"
+	case wasRunning && running:
+		res.Stream = "unchanged"
+	case wasRunning:
+		res.Stream = "stopped"
+	case running:
+		res.Stream = "started"
+	}
+	p.logEvent(levelInfo, "config_reloaded", logFields{"changed": res.Changed, "stream": res.Stream},
+		"Config reloaded, changed: %v, stream: %s", res.Changed, res.Stream)
+	return res, nil
+}
+
+// cloneConfig 通过 JSON 深拷贝配置的导出字段，未导出的字段由 ValidateAndSetConfig 重新生成
+// 校验会就地规范化切片中的元素，浅拷贝会修改仍在被读取的当前配置
+func cloneConfig(c *Config) (*Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to copy config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// hasStreamRoutes 判断配置中是否有需要消息流的路由
+func hasStreamRoutes(c *Config) bool {
+	return len(c.MessageRoutes) > 0 || len(c.Routes) > 0
+}
+
+// configChanges 按 JSON 配置项比较两份配置，返回发生变化的配置项名称（已排序）
+func configChanges(old, cfg *Config) []string {
+	a, b := configValues(old), configValues(cfg)
+	changed := []string{}
+	for key, v := range b {
+		if !reflect.DeepEqual(a[key], v) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// configValues 将配置编码为「配置项 -> 值」，编码失败时返回空表
+func configValues(c *Config) map[string]interface{} {
+	values := make(map[string]interface{})
+	data, err := json.Marshal(c)
+	if err != nil {
+		return values
+	}
+	_ = json.Unmarshal(data, &values)
+	return values
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// pluginStorage 插件持久化数据
+// StorageHandler 只提供单个 blob，所有需要持久化的内容都放在这里
+type pluginStorage struct {
+	Stats  *persistedStats           `json:"stats,omitempty"`
+	Tokens map[string]persistedToken `json:"tokens,omitempty"` // 按 AppID 区分
+
+	// 发送失败的消息，从旧到新；DeadLetterSeq 为最近分配的死信 ID
+	DeadLetters   []DeadLetter `json:"dead_letters,omitempty"`
+	DeadLetterSeq int64        `json:"dead_letter_seq,omitempty"`
+}
+
+// persistedToken 持久化的 access_token
+type persistedToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// persistedStats 消息统计快照
+type persistedStats struct {
+	TotalSent      int64            `json:"total_sent"`
+	TotalFail      int64            `json:"total_fail"`
+	TotalFiltered  int64            `json:"total_filtered"`
+	Escalations    int64            `json:"escalations,omitempty"`
+	LastSentAt     time.Time        `json:"last_sent_at"`
+	LastError      string           `json:"last_error"`
+	LastErrorCount int64            `json:"last_error_count"`
+	LastErrorFirst time.Time        `json:"last_error_first_seen"`
+	LastErrorLast  time.Time        `json:"last_error_last_seen"`
+	Filtered       map[string]int64 `json:"filtered"`
+	Sent           map[string]int64 `json:"sent,omitempty"`
+	Failed         map[string]int64 `json:"failed,omitempty"`
+}
+
+// loadToken 读取指定 AppID 持久化的 access_token，数据损坏或不存在时返回 false
+func (p *WeChatPlugin) loadToken(appID string) (persistedToken, bool) {
+	data, err := p.loadStorage()
+	if err != nil {
+		p.logEvent(levelWarn, "storage_error", logFields{"error": err}, "Ignoring stored token: %v", err)
+		return persistedToken{}, false
+	}
+	t, ok := data.Tokens[appID]
+	if !ok || t.Token == "" || t.ExpiresAt.IsZero() {
+		return persistedToken{}, false
+	}
+	return t, true
+}
+
+// saveToken 持久化指定 AppID 的 access_token，失败仅记录日志
+func (p *WeChatPlugin) saveToken(appID, token string, expiresAt time.Time) {
+	err := p.updateStorage(func(data *pluginStorage) {
+		if data.Tokens == nil {
+			data.Tokens = make(map[string]persistedToken)
+		}
+		data.Tokens[appID] = persistedToken{Token: token, ExpiresAt: expiresAt}
+	})
+	if err != nil {
+		p.logEvent(levelError, "storage_error", logFields{"error": err}, "Failed to persist access token: %v", err)
+	}
+}
+
+// deleteToken 删除指定 AppID 持久化的 access_token（仅当与 token 相同时）
+func (p *WeChatPlugin) deleteToken(appID, token string) {
+	err := p.updateStorage(func(data *pluginStorage) {
+		if t, ok := data.Tokens[appID]; ok && t.Token == token {
+			delete(data.Tokens, appID)
+		}
+	})
+	if err != nil {
+		p.logEvent(levelError, "storage_error", logFields{"error": err}, "Failed to delete stored access token: %v", err)
+	}
+}
+
+// loadStorage 读取持久化数据，无数据时返回空结构
+func (p *WeChatPlugin) loadStorage() (*pluginStorage, error) {
+	data := &pluginStorage{}
+	if p.storage == nil {
+		return data, nil
+	}
+
+	b, err := p.storage.Load()
+	if err != nil {
+		return data, fmt.Errorf("failed to load storage: %w", err)
+	}
+	if len(b) == 0 {
+		return data, nil
+	}
+	if err := json.Unmarshal(b, data); err != nil {
+		return &pluginStorage{}, fmt.Errorf("failed to parse storage: %w", err)
+	}
+	return data, nil
+}
+
+// updateStorage 读取-修改-写回持久化数据
+func (p *WeChatPlugin) updateStorage(fn func(data *pluginStorage)) error {
+	if p.storage == nil {
+		return nil
+	}
+
+	p.storageMu.Lock()
+	defer p.storageMu.Unlock()
+
+	data, err := p.loadStorage()
+	if err != nil {
+		// 数据损坏时以空结构覆盖，避免永久写入失败
+		p.logEvent(levelWarn, "storage_reset", logFields{"error": err}, "%v, resetting storage", err)
+	}
+	fn(data)
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage: %w", err)
+	}
+	if err := p.storage.Save(b); err != nil {
+		return fmt.Errorf("failed to save storage: %w", err)
+	}
+	return nil
+}
+
+// restoreStats 从持久化数据恢复消息统计，仅在插件进程内首次启用时执行
+func (p *WeChatPlugin) restoreStats() {
+	if p.statsRestored {
+		return
+	}
+	p.statsRestored = true
+
+	data, err := p.loadStorage()
+	if err != nil {
+		p.logEvent(levelWarn, "storage_error", logFields{"error": err}, "Failed to restore stats: %v", err)
+		return
+	}
+	if data.Stats != nil {
+		p.msgMgr.Restore(*data.Stats)
+	}
+}
+
+// flushStats 将内存中的统计写入持久化存储，统计未变化时跳过
+func (p *WeChatPlugin) flushStats() {
+	version := p.msgMgr.Version()
+	if version == p.statsFlushedVersion.Load() {
+		return
+	}
+
+	snapshot := p.msgMgr.Snapshot()
+	err := p.updateStorage(func(data *pluginStorage) {
+		data.Stats = &snapshot
+	})
+	if err != nil {
+		p.logEvent(levelError, "storage_error", logFields{"error": err}, "Failed to persist stats: %v", err)
+		return
+	}
+	p.statsFlushedVersion.Store(version)
+}
+
+// runStatsFlusher 按 interval 周期性写入统计，直到 stop 关闭
+func (p *WeChatPlugin) runStatsFlusher(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.flushStats()
+		case <-stop:
+			return
+		}
+	}
+}
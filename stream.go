@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"math/rand/v2"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,74 +30,256 @@ type GotifyMessage struct {
 	Extras   map[string]interface{} `json:"extras"`
 }
 
-// MessageRouter 消息路由器，根据配置的路径规则过滤消息
+// MessageRouter 消息路由器，根据路由规则决定消息发送给哪些接收者
 type MessageRouter struct {
-	appIDs   map[int64]bool
-	allowAll bool
+	routes   []compiledRoute // routes 配置的路由
+	fallback []compiledRoute // 由旧版 message_routes 转换，未命中 routes 时使用，发送给全部接收者
 }
 
-// 从路径末尾提取数字的正则
-var pathIDRegex = regexp.MustCompile(`(\d+)$`)
+// compiledRoute 预编译了匹配条件的路由
+type compiledRoute struct {
+	Route
+	title *regexp.Regexp // 由 Match.TitlePattern 编译，为空表示不限制标题
+
+	// 关键词，不区分大小写时已转为小写
+	contains    []string
+	notContains []string
+}
 
-// NewMessageRouter 解析路径规则，构建路由器
-func NewMessageRouter(routes []MessageRoute) *MessageRouter {
-	r := &MessageRouter{
-		appIDs: make(map[int64]bool),
+// foldKeywords 不区分大小写时将关键词转为小写
+func foldKeywords(keywords []string, caseSensitive bool) []string {
+	if caseSensitive || len(keywords) == 0 {
+		return keywords
+	}
+	folded := make([]string, len(keywords))
+	for i, kw := range keywords {
+		folded[i] = strings.ToLower(kw)
 	}
+	return folded
+}
 
-	for _, route := range routes {
-		path := strings.TrimSpace(route.Path)
+// containsAny 判断 s 是否包含任意一个关键词
+func containsAny(s string, keywords []string) bool {
+	for _, kw := range keywords {
+		if strings.Contains(s, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteResult 路由匹配结果
+type RouteResult struct {
+	Routes []Route // 命中的路由
+	All    bool    // 是否发送给全部接收者
+}
+
+// 从路径末尾提取数字的正则
+var pathIDRegex = regexp.MustCompile(`(\d+)$`)
+
+// legacyRoutes 将旧版路径规则转换为路由：路径末尾的数字作为 appid，"*" 匹配所有消息
+func legacyRoutes(paths []MessageRoute) []Route {
+	routes := make([]Route, 0, len(paths))
+	for _, mr := range paths {
+		path := strings.TrimSpace(mr.Path)
 		if path == "*" {
-			r.allowAll = true
-			return r
+			return []Route{{Name: path}}
 		}
 
 		// 从路径末尾提取数字作为 appid
 		matches := pathIDRegex.FindStringSubmatch(path)
 		if len(matches) == 2 {
 			if id, err := strconv.ParseInt(matches[1], 10, 64); err == nil {
-				r.appIDs[id] = true
+				routes = append(routes, Route{Name: path, Match: RouteMatch{AppID: &id}})
 			}
 		}
 	}
+	return routes
+}
 
-	return r
+// NewMessageRouter 构建路由器，fallback 规则仅在 routes 均未命中时生效
+// 标题正则在此编译一次，配置校验已保证其合法
+func NewMessageRouter(routes, fallback []Route) *MessageRouter {
+	return &MessageRouter{
+		routes:   compileRoutes(routes),
+		fallback: compileRoutes(fallback),
+	}
 }
 
-// Match 判断消息是否匹配路由规则
-func (r *MessageRouter) Match(msg GotifyMessage) bool {
-	if r.allowAll {
-		return true
+// compileRoutes 预编译路由的匹配条件
+func compileRoutes(routes []Route) []compiledRoute {
+	compiled := make([]compiledRoute, 0, len(routes))
+	for _, route := range routes {
+		cr := compiledRoute{
+			Route:       route,
+			contains:    foldKeywords(route.Match.MessageContains, route.Match.CaseSensitive),
+			notContains: foldKeywords(route.Match.MessageNotContains, route.Match.CaseSensitive),
+		}
+		if route.Match.TitlePattern != "" {
+			re, err := regexp.Compile(route.Match.TitlePattern)
+			if err != nil {
+				continue
+			}
+			cr.title = re
+		}
+		compiled = append(compiled, cr)
 	}
-	return r.appIDs[msg.AppID]
+	return compiled
+}
+
+// matchRoute 判断消息是否满足路由条件，所有已设置的条件需同时满足
+func matchRoute(route compiledRoute, msg GotifyMessage) bool {
+	if route.Match.AppID != nil && *route.Match.AppID != msg.AppID {
+		return false
+	}
+	if route.Match.MinPriority != nil && msg.Priority < *route.Match.MinPriority {
+		return false
+	}
+	if route.title != nil && !route.title.MatchString(msg.Title) {
+		return false
+	}
+	if len(route.contains) > 0 || len(route.notContains) > 0 {
+		body := msg.Message
+		if !route.Match.CaseSensitive {
+			body = strings.ToLower(body)
+		}
+		if len(route.contains) > 0 && !containsAny(body, route.contains) {
+			return false
+		}
+		if containsAny(body, route.notContains) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve 返回消息命中的路由；routes 均未命中时：配置了旧版路径规则则按其过滤，命中时发送给全部接收者、
+// 否则丢弃；只配置了 routes 时发送给全部接收者。未配置任何规则时返回 false
+func (r *MessageRouter) Resolve(msg GotifyMessage) (RouteResult, bool) {
+	var res RouteResult
+	for _, route := range r.routes {
+		if matchRoute(route, msg) {
+			res.Routes = append(res.Routes, route.Route)
+			if len(route.Recipients) == 0 {
+				res.All = true
+			}
+		}
+	}
+	if len(res.Routes) > 0 {
+		return res, true
+	}
+
+	if len(r.fallback) == 0 {
+		if len(r.routes) == 0 {
+			return RouteResult{}, false
+		}
+		return RouteResult{All: true}, true
+	}
+	for _, route := range r.fallback {
+		if matchRoute(route, msg) {
+			return RouteResult{All: true}, true
+		}
+	}
+	return RouteResult{}, false
 }
 
 // StreamListener WebSocket 流监听器
 type StreamListener struct {
 	plugin *WeChatPlugin
 	conn   *websocket.Conn
-	router *MessageRouter
 	stopCh chan struct{}
 	done   chan struct{}
 	mu     sync.Mutex
+
+	// ctx 派生自插件的 runCtx，Stop 或 Disable 时取消，用于中断补发消息的 REST 请求
+	ctx    context.Context
+	cancel context.CancelFunc
+	tasks  sync.WaitGroup // 补发消息等后台协程，Stop 时等待其退出
+
+	connectedAt time.Time    // 当前连接建立时间，受 mu 保护
+	reconnects  atomic.Int64 // 断线重连次数
+	authFailed  atomic.Bool  // client_token 被拒绝，已停止重连
+	failures    atomic.Int64 // 连续连接失败次数，连接成功后清零
+	lastID      atomic.Int64 // 已收到的最大消息 ID，重连后据此补发错过的消息
+	seen        *idSet       // 最近转发过的消息 ID，避免补发与实时消息重复转发
+
+	forwarded     atomic.Int64 // 转发到微信（含进入合并缓冲）的消息数
+	filtered      atomic.Int64 // 被排除应用、路由、优先级、静默时段等规则过滤的消息数
+	lastMessageAt time.Time    // 最近一条转发的消息时间，受 mu 保护
+
+	client *http.Client  // 补发消息时调用 Gotify REST API，连接复用
+	digest *digestBuffer // 合并推送，未启用时为 nil
+
+	// gorilla/websocket 不允许并发写，所有写操作（ping、close 帧）通过 writeMu 串行化
+	writeMu sync.Mutex
 }
 
+// gotifyTLSConfig 连接 Gotify 使用的 TLS 配置，未开启 skip_tls_verify 时返回 nil 使用默认配置
+func gotifyTLSConfig(c *Config) *tls.Config {
+	if !c.SkipTLSVerify {
+		return nil
+	}
+	return &tls.Config{InsecureSkipVerify: true}
+}
+
+// newGotifyHTTPClient 创建调用 Gotify REST API 的 HTTP 客户端，与消息流使用相同的 TLS 配置
+func newGotifyHTTPClient(c *Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = gotifyTLSConfig(c)
+	return &http.Client{Timeout: c.HTTPTimeout, Transport: transport}
+}
+
+// wsWriteTimeout 单次 WebSocket 写操作的超时
+const wsWriteTimeout = 10 * time.Second
+
 // NewStreamListener 创建流监听器
 func NewStreamListener(p *WeChatPlugin) *StreamListener {
-	return &StreamListener{
+	cfg := p.configSnapshot()
+	s := &StreamListener{
 		plugin: p,
-		router: NewMessageRouter(p.config.MessageRoutes),
+		seen:   newIDSet(cfg.DedupWindow),
+		client: newGotifyHTTPClient(cfg),
 		stopCh: make(chan struct{}),
 		done:   make(chan struct{}),
 	}
+	s.ctx, s.cancel = context.WithCancel(p.runContext())
+	if cfg.DigestWindow > 0 {
+		s.digest = newDigestBuffer(cfg.DigestWindow, cfg.DigestMaxCount, func(recipients []Recipient, msgs []OutgoingMessage) {
+			p.sendToMultiple(recipients, mergeDigest(msgs, p.configSnapshot().Language))
+		})
+	}
+	return s
+}
+
+// streamAuthError Gotify 拒绝了 client_token，重连无法恢复，需要修改配置
+type streamAuthError struct {
+	reason string
+}
+
+func (e *streamAuthError) Error() string {
+	return "client_token rejected by Gotify: " + e.reason
+}
+
+// isAuthCloseCode 判断 WebSocket close code 是否表示认证失败：4001（未授权）和 1008（策略违规）
+func isAuthCloseCode(code int) bool {
+	return code == 4001 || code == websocket.ClosePolicyViolation
+}
+
+// jitterBackoff 在 backoff 的 ±jitter 比例内随机取等待时间，结果不超过 maxBackoff
+func jitterBackoff(backoff time.Duration, jitter float64, maxBackoff time.Duration) time.Duration {
+	if jitter > 0 {
+		backoff = time.Duration(float64(backoff) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	return min(backoff, maxBackoff)
 }
 
 // Start 启动监听（在 goroutine 中运行，含自动重连）
 func (s *StreamListener) Start() {
 	defer close(s.done)
 
-	backoff := time.Second
-	maxBackoff := 2 * time.Minute
+	cfg := s.plugin.configSnapshot()
+	backoff := cfg.ReconnectInitialBackoff
+	maxBackoff := cfg.ReconnectMaxBackoff
 
 	for {
 		select {
@@ -109,11 +296,35 @@ func (s *StreamListener) Start() {
 			default:
 			}
 
-			log.Printf("[WeChat Plugin] Stream disconnected: %v, reconnecting in %v", err, backoff)
-			s.plugin.msgMgr.NotifyError("Stream 连接断开", []error{err}, 1)
+			// token 被拒绝时重连没有意义，停止重连并通知，修改配置后通过 /reload 或重新启用恢复
+			var authErr *streamAuthError
+			if errors.As(err, &authErr) {
+				s.authFailed.Store(true)
+				s.plugin.logEvent(levelError, "stream_auth_failed", logFields{"error": err},
+					"Stream stopped: %v, check client_token", err)
+				s.plugin.msgMgr.NotifyStreamAuthFailed(err)
+				return
+			}
+
+			// 不涉及消息流配置的 /reload 不会重启监听，通知相关配置每次重连时重新读取
+			cfg = s.plugin.configSnapshot()
+			s.reconnects.Add(1)
+			failures := s.failures.Add(1)
+			if failures == 1 {
+				// 上次连接成功过，重新从初始退避时间开始
+				backoff = cfg.ReconnectInitialBackoff
+			}
+			wait := jitterBackoff(backoff, cfg.ReconnectJitter, maxBackoff)
+			s.plugin.logEvent(levelWarn, "stream_disconnected", logFields{"error": err, "backoff": wait.String(), "failures": failures},
+				"Stream disconnected: %v, reconnecting in %v", err, wait)
+			// 每次持续断线只通知一次
+			if !cfg.DisableStreamErrorNotify && failures == int64(cfg.StreamErrorThreshold) {
+				s.plugin.msgMgr.NotifyError(cfg.text("stream_error_title"),
+					[]error{fmt.Errorf(cfg.text("stream_error_message"), failures, err)}, 1)
+			}
 
 			select {
-			case <-time.After(backoff):
+			case <-time.After(wait):
 				backoff *= 2
 				if backoff > maxBackoff {
 					backoff = maxBackoff
@@ -128,14 +339,35 @@ func (s *StreamListener) Start() {
 // Stop 停止监听
 func (s *StreamListener) Stop() {
 	close(s.stopCh)
+	s.cancel()
 
 	s.mu.Lock()
 	if s.conn != nil {
+		// 尽力发送 close 帧，失败时直接关闭连接
+		_ = s.write(s.conn, websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 		s.conn.Close()
 	}
 	s.mu.Unlock()
 
 	<-s.done
+	s.tasks.Wait()
+	s.seen.clear()
+	if s.digest != nil {
+		// 停止前发送仍在等待合并的消息，避免丢失
+		s.digest.flushAll()
+	}
+}
+
+// write 串行化地向连接写入一帧
+func (s *StreamListener) write(conn *websocket.Conn, messageType int, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return conn.WriteMessage(messageType, data)
 }
 
 // Connected 返回当前是否已连接
@@ -145,58 +377,99 @@ func (s *StreamListener) Connected() bool {
 	return s.conn != nil
 }
 
-// resolveGotifyURL 解析 Gotify WebSocket URL（自动发现或手动配置）
-func (s *StreamListener) resolveGotifyURL() (string, error) {
-	baseURL := s.plugin.config.GotifyURL
-	if strings.TrimSpace(baseURL) == "" {
-		baseURL = "http://localhost"
+// ConnectedSince 返回当前连接的建立时间，未连接时返回零值
+func (s *StreamListener) ConnectedSince() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return time.Time{}
 	}
+	return s.connectedAt
+}
 
-	// 确保有 scheme
-	if !strings.Contains(baseURL, "://") {
-		baseURL = "http://" + baseURL
+// AuthFailed 返回是否因 client_token 被拒绝而停止了重连
+func (s *StreamListener) AuthFailed() bool {
+	return s.authFailed.Load()
+}
+
+// Reconnects 返回断线重连次数
+func (s *StreamListener) Reconnects() int64 {
+	return s.reconnects.Load()
+}
+
+// gotifyBaseURL 解析 Gotify 服务器地址（自动发现或手动配置），scheme 统一为 http/https
+func gotifyBaseURL(c *Config) (*url.URL, error) {
+	baseURL := c.GotifyURL
+	if strings.TrimSpace(baseURL) == "" {
+		baseURL = "http://localhost"
 	}
+	return normalizeGotifyURL(baseURL)
+}
 
-	parsed, err := url.Parse(baseURL)
+// resolveGotifyURL 解析 Gotify WebSocket URL
+func (s *StreamListener) resolveGotifyURL() (string, error) {
+	cfg := s.plugin.configSnapshot()
+	parsed, err := gotifyBaseURL(cfg)
 	if err != nil {
-		return "", fmt.Errorf("invalid gotify_url: %w", err)
+		return "", err
 	}
 
 	// HTTP -> WS, HTTPS -> WSS
-	switch parsed.Scheme {
-	case "https":
+	if parsed.Scheme == "https" {
 		parsed.Scheme = "wss"
-	default:
+	} else {
 		parsed.Scheme = "ws"
 	}
 
 	// 构建 /stream 路径
 	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/stream"
 
-	// 添加 client token
-	q := parsed.Query()
-	q.Set("token", s.plugin.config.ClientToken)
-	parsed.RawQuery = q.Encode()
+	// 旧版 Gotify 只支持通过查询参数传递 client token，默认改用请求头，避免 token 出现在访问日志中
+	if cfg.StreamTokenInQuery {
+		q := parsed.Query()
+		q.Set("token", cfg.ClientToken)
+		parsed.RawQuery = q.Encode()
+	}
 
 	return parsed.String(), nil
 }
 
 // connectAndListen 建立连接并监听消息，返回错误时触发重连
 func (s *StreamListener) connectAndListen() error {
+	cfg := s.plugin.configSnapshot()
 	wsURL, err := s.resolveGotifyURL()
 	if err != nil {
 		return err
 	}
 
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.Dial(wsURL, nil)
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: cfg.StreamHandshakeTimeout,
+		TLSClientConfig:  gotifyTLSConfig(cfg),
+	}
+	var header http.Header
+	if !cfg.StreamTokenInQuery {
+		header = http.Header{"X-Gotify-Key": []string{cfg.ClientToken}}
+	}
+	conn, resp, err := dialer.Dial(wsURL, header)
 	if err != nil {
-		return fmt.Errorf("websocket dial failed: %w", err)
+		// 握手失败时 resp 仍持有连接，读取状态码后关闭 Body 释放连接
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+			resp.Body.Close()
+		}
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			return &streamAuthError{reason: fmt.Sprintf("handshake rejected with HTTP %d", status)}
+		}
+		return fmt.Errorf("websocket dial failed: %w", redactURLError(err))
 	}
 
 	s.mu.Lock()
 	s.conn = conn
+	s.connectedAt = time.Now()
 	s.mu.Unlock()
+	s.failures.Store(0)
 
 	defer func() {
 		s.mu.Lock()
@@ -205,7 +478,43 @@ func (s *StreamListener) connectAndListen() error {
 		s.mu.Unlock()
 	}()
 
-	log.Printf("[WeChat Plugin] Connected to Gotify stream")
+	s.plugin.logEvent(levelInfo, "stream_connected", nil, "Connected to Gotify stream")
+
+	// 连接建立后再补发，确保断线期间与补发期间的消息都不会遗漏
+	after := s.lastID.Load()
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		s.recoverMissed(s.ctx, after)
+	}()
+
+	// 心跳：定期发送 ping，收到 pong 或任何数据时延长读超时；
+	// NAT 超时等静默断开的连接会因读超时而返回错误，进入重连
+	interval := cfg.PingInterval
+	extend := func() error {
+		if interval <= 0 {
+			return nil
+		}
+		return conn.SetReadDeadline(time.Now().Add(2 * interval))
+	}
+	if interval > 0 {
+		if err := extend(); err != nil {
+			return fmt.Errorf("set read deadline failed: %w", err)
+		}
+		conn.SetPongHandler(func(string) error {
+			return extend()
+		})
+		conn.SetPingHandler(func(data string) error {
+			if err := extend(); err != nil {
+				return err
+			}
+			return s.write(conn, websocket.PongMessage, []byte(data))
+		})
+
+		stopPing := make(chan struct{})
+		defer close(stopPing)
+		go s.keepalive(conn, interval, stopPing)
+	}
 
 	for {
 		select {
@@ -216,38 +525,207 @@ func (s *StreamListener) connectAndListen() error {
 
 		_, message, err := conn.ReadMessage()
 		if err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				s.plugin.logEvent(levelWarn, "stream_closed", logFields{"close_code": ce.Code, "close_reason": ce.Text},
+					"Stream closed by server with code %d: %s", ce.Code, ce.Text)
+				if isAuthCloseCode(ce.Code) {
+					return &streamAuthError{reason: fmt.Sprintf("connection closed with code %d: %s", ce.Code, ce.Text)}
+				}
+				return fmt.Errorf("connection closed by server (code %d: %s): %w", ce.Code, ce.Text, err)
+			}
 			return fmt.Errorf("read message failed: %w", err)
 		}
+		_ = extend()
 
 		var msg GotifyMessage
 		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("[WeChat Plugin] Failed to parse stream message: %v", err)
+			s.plugin.logEvent(levelWarn, "stream_parse_failed", logFields{"error": err}, "Failed to parse stream message: %v", err)
 			continue
 		}
 
-		if s.router.Match(msg) {
-			go s.forwardToWeChat(msg)
+		s.handle(msg)
+	}
+}
+
+// handle 记录消息 ID 并按路由转发
+func (s *StreamListener) handle(msg GotifyMessage) {
+	s.observe(msg.ID)
+	if !s.seen.add(msg.ID) {
+		s.plugin.logEvent(levelInfo, "message_duplicate", logFields{"message_id": msg.ID}, "Skipping duplicate message %d", msg.ID)
+		return
+	}
+	// 被排除的应用在路由匹配之前直接丢弃
+	if s.plugin.configSnapshot().excludedApp(msg.AppID) {
+		s.filtered.Add(1)
+		return
+	}
+	groups, ok := s.plugin.routeMessage(msg)
+	if !ok {
+		s.filtered.Add(1)
+		return
+	}
+	go s.forwardToWeChat(msg, groups)
+}
+
+// keepalive 按 interval 发送 ping，直到 stop 关闭或写入失败
+func (s *StreamListener) keepalive(conn *websocket.Conn, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write(conn, websocket.PingMessage, nil); err != nil {
+				s.plugin.logEvent(levelWarn, "stream_ping_failed", logFields{"error": err}, "Stream ping failed: %v", err)
+				return
+			}
+		case <-stop:
+			return
 		}
 	}
 }
 
 // forwardToWeChat 将 Gotify 消息转发到微信
-func (s *StreamListener) forwardToWeChat(msg GotifyMessage) {
+func (s *StreamListener) forwardToWeChat(msg GotifyMessage, groups []recipientGroup) {
+	cfg := s.plugin.configSnapshot()
+	out, skip := s.plugin.buildOutgoing(msg)
+	if skip != "" {
+		s.filtered.Add(1)
+		return
+	}
+
+	if msg.Priority < cfg.QuietMinPriority && cfg.inQuietHours(time.Now()) {
+		s.plugin.logEvent(levelInfo, "message_skipped", logFields{"message_id": msg.ID, "priority": msg.Priority, "reason": "quiet_hours"},
+			"Quiet hours, skipping message %d (priority %d)", msg.ID, msg.Priority)
+		s.filtered.Add(1)
+		return
+	}
+
+	if len(groups) == 0 {
+		s.plugin.logEvent(levelInfo, "message_skipped", logFields{"message_id": msg.ID, "reason": "no_recipients"}, "No recipients configured, skipping message %d", msg.ID)
+		s.filtered.Add(1)
+		return
+	}
+
+	if !s.plugin.allowForward() {
+		s.plugin.logEvent(levelInfo, "message_skipped", logFields{"message_id": msg.ID, "reason": "paused"}, "Forwarding paused, skipping message %d", msg.ID)
+		s.filtered.Add(1)
+		return
+	}
+
+	s.recordForwarded()
+	for _, g := range groups {
+		out.Account = g.Account
+		if s.digest != nil {
+			s.digest.add(g.Recipients, out)
+			continue
+		}
+		s.plugin.sendToMultiple(g.Recipients, out)
+	}
+}
+
+// buildOutgoing 按全局过滤规则和格式化配置将 Gotify 消息转换为待发送的消息
+// 消息被过滤时返回跳过原因，否则返回空字符串
+func (p *WeChatPlugin) buildOutgoing(msg GotifyMessage) (OutgoingMessage, string) {
+	cfg := p.configSnapshot()
+	// 跳过插件自身发出的通知，避免转发循环
+	if _, ok := msg.Extras[selfMessageExtrasKey]; ok {
+		return OutgoingMessage{}, "self_message"
+	}
+
+	if msg.Priority < cfg.GlobalMinPriority {
+		p.logEvent(levelInfo, "message_skipped", logFields{"message_id": msg.ID, "priority": msg.Priority, "reason": "global_min_priority"},
+			"Priority %d below global_min_priority, skipping message %d", msg.Priority, msg.ID)
+		return OutgoingMessage{}, "global_min_priority"
+	}
+
+	if limit := cfg.MaxMessageBytes; limit > 0 && len(msg.Message) > limit {
+		fields := logFields{"message_id": msg.ID, "bytes": len(msg.Message), "limit": limit, "action": cfg.OversizeAction}
+		if cfg.OversizeAction == oversizeDrop {
+			p.logEvent(levelWarn, "message_oversize", fields, "Message %d is %d bytes, exceeds max_message_bytes %d, dropping", msg.ID, len(msg.Message), limit)
+			return OutgoingMessage{}, "oversize"
+		}
+		p.logEvent(levelWarn, "message_oversize", fields, "Message %d is %d bytes, exceeds max_message_bytes %d, truncating", msg.ID, len(msg.Message), limit)
+		msg.Message = truncateBytes(msg.Message, limit)
+	}
+
 	title := msg.Title
 	if title == "" {
 		title = "Gotify Notification"
 	}
 
-	content := msg.Message
+	date, err := time.Parse(time.RFC3339, msg.Date)
+	if err != nil {
+		date = time.Now()
+	}
+
+	// 按内容类型处理，force_plain_text 时一律按纯文本处理
+	contentType := messageContentType(msg.Extras)
+	if cfg.ForcePlainText {
+		contentType = contentTypePlain
+	}
+	switch contentType {
+	case contentTypeMarkdown:
+		if cfg.FlattenMarkdown {
+			msg.Message = flattenMarkdown(msg.Message)
+		}
+	case contentTypePlain:
+		// 纯文本原样转发
+	}
+
+	content, err := cfg.renderContent(msg, date)
+	if err != nil {
+		p.logEvent(levelWarn, "template_failed", logFields{"message_id": msg.ID, "error": err}, "%v, using raw content for message %d", err, msg.ID)
+	}
 	if content == "" {
 		content = "(empty message)"
 	}
+	if cfg.PrefixAppName && msg.AppID != 0 {
+		content = fmt.Sprintf("[%s] %s", cfg.appName(msg.AppID), content)
+	}
 
-	openIDs := s.plugin.getAllOpenIDs()
-	if len(openIDs) == 0 {
-		log.Printf("[WeChat Plugin] No recipients configured, skipping message %d", msg.ID)
-		return
+	out := OutgoingMessage{
+		Title:    title,
+		Content:  content,
+		Priority: msg.Priority,
+		Date:     date,
+		AppID:    msg.AppID,
+		ImageURL: extrasImageURL(msg.Extras),
+	}
+	fields, ignored := extrasFields(msg.Extras, cfg.ExtrasFieldsKey)
+	if len(ignored) > 0 {
+		p.logEvent(levelWarn, "extras_fields_ignored", logFields{"message_id": msg.ID, "fields": ignored},
+			"Ignoring non-string %s values %v in message %d", cfg.ExtrasFieldsKey, ignored, msg.ID)
 	}
+	out.Fields = fields
+	return out, ""
+}
 
-	s.plugin.sendToMultiple(openIDs, title, content)
+// recordForwarded 记录一条转发的消息
+func (s *StreamListener) recordForwarded() {
+	s.forwarded.Add(1)
+	s.mu.Lock()
+	s.lastMessageAt = time.Now()
+	s.mu.Unlock()
+}
+
+// Forwarded 返回转发和被过滤的消息数
+func (s *StreamListener) Forwarded() (forwarded, filtered int64) {
+	return s.forwarded.Load(), s.filtered.Load()
+}
+
+// DigestPending 返回合并缓冲中等待发送的批次数和消息数，未启用合并推送时为 0
+func (s *StreamListener) DigestPending() (batches, messages int) {
+	if s.digest == nil {
+		return 0, 0
+	}
+	return s.digest.pending()
+}
+
+// LastMessageAt 返回最近一条转发的消息时间，尚未转发时返回零值
+func (s *StreamListener) LastMessageAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastMessageAt
 }
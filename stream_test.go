@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestKeepalivePingsWhileReading 服务器持续推送消息并发送 ping 时，客户端的心跳 ping、
+// pong 回复和读取并发进行，需配合 go test -race 运行
+func TestKeepalivePingsWhileReading(t *testing.T) {
+	var pings, pongs, sent atomic.Int64
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/message":
+			_, _ = w.Write([]byte(`{"messages":[],"paging":{}}`))
+			return
+		case "/stream":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Gotify-Key") != "client-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// ping 处理函数在读取协程中回复 pong，与推送消息的写入需加锁
+		var writeMu sync.Mutex
+		write := func(messageType int, data []byte) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return conn.WriteMessage(messageType, data)
+		}
+		conn.SetPingHandler(func(data string) error {
+			pings.Add(1)
+			return write(websocket.PongMessage, []byte(data))
+		})
+		conn.SetPongHandler(func(string) error {
+			pongs.Add(1)
+			return nil
+		})
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for id := int64(1); ; id++ {
+			msg, _ := json.Marshal(GotifyMessage{ID: id, AppID: 1, Title: "title", Message: "message"})
+			if err := write(websocket.TextMessage, msg); err != nil {
+				return
+			}
+			sent.Add(1)
+			if err := write(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.GotifyURL = srv.URL
+	c.ClientToken = "client-token"
+	c.PingInterval = 10 * time.Millisecond
+	p := newTestPlugin(t, &mockWeChat{}, c)
+
+	s := NewStreamListener(p)
+	go s.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pings.Load() < 5 || pongs.Load() < 5 || sent.Load() < 20 {
+		if time.Now().After(deadline) {
+			s.Stop()
+			t.Fatalf("timed out: %d pings, %d pongs, %d messages", pings.Load(), pongs.Load(), sent.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !s.Connected() {
+		t.Error("stream disconnected while pinging")
+	}
+	if got := s.Reconnects(); got != 0 {
+		t.Errorf("reconnects = %d, want 0", got)
+	}
+	s.Stop()
+}
+
+func TestMatchRouteMinPriority(t *testing.T) {
+	five := 5
+	appID := int64(3)
+	tests := []struct {
+		name     string
+		match    RouteMatch
+		priority int
+		want     bool
+	}{
+		{"unset matches priority 0", RouteMatch{}, 0, true},
+		{"unset matches high priority", RouteMatch{}, 10, true},
+		{"below threshold", RouteMatch{MinPriority: &five}, 4, false},
+		{"at threshold", RouteMatch{MinPriority: &five}, 5, true},
+		{"above threshold", RouteMatch{MinPriority: &five}, 8, true},
+		{"at threshold but other app", RouteMatch{MinPriority: &five, AppID: &appID}, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := compileRoutes([]Route{{Name: tt.name, Match: tt.match}})[0]
+			msg := GotifyMessage{AppID: 1, Priority: tt.priority, Title: "title", Message: "message"}
+			if got := matchRoute(route, msg); got != tt.want {
+				t.Errorf("matchRoute(priority %d) = %v, want %v", tt.priority, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStopCancelsRecovery Stop 应取消挂起的补发请求，并等待补发协程退出
+func TestStopCancelsRecovery(t *testing.T) {
+	requested := make(chan struct{})
+	cancelled := make(chan struct{})
+	var once sync.Once
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/message":
+			// 模拟无响应的 Gotify，直到请求被取消
+			once.Do(func() { close(requested) })
+			<-r.Context().Done()
+			close(cancelled)
+		case "/stream":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.GotifyURL = srv.URL
+	c.ClientToken = "client-token"
+	c.HTTPTimeout = time.Minute
+	p := newTestPlugin(t, &mockWeChat{}, c)
+
+	s := NewStreamListener(p)
+	go s.Start()
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		s.Stop()
+		t.Fatal("recovery request was not sent")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return while recovery was pending")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recovery request was not cancelled")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	seven := int64(7)
+	five := 5
+	oncall := Route{Name: "oncall", Match: RouteMatch{AppID: &seven}, Recipients: []string{"alice"}}
+	urgent := Route{Name: "urgent", Match: RouteMatch{MinPriority: &five}, Recipients: []string{"bob"}}
+	everyone := Route{Name: "everyone", Match: RouteMatch{AppID: &seven}}
+	legacy := legacyRoutes([]MessageRoute{{Path: "messages/3"}})
+
+	tests := []struct {
+		name     string
+		routes   []Route
+		fallback []Route
+		msg      GotifyMessage
+		want     []string
+		all      bool
+		ok       bool
+	}{
+		{"no rules", nil, nil, GotifyMessage{AppID: 7}, nil, false, false},
+		{"no route matched sends to all", []Route{oncall}, nil, GotifyMessage{AppID: 1}, nil, true, true},
+		{"match with empty recipients", []Route{everyone}, nil, GotifyMessage{AppID: 7}, []string{"everyone"}, true, true},
+		{"multiple matches", []Route{oncall, urgent}, nil, GotifyMessage{AppID: 7, Priority: 8}, []string{"oncall", "urgent"}, false, true},
+		{"one of several matches", []Route{oncall, urgent}, nil, GotifyMessage{AppID: 7, Priority: 1}, []string{"oncall"}, false, true},
+		{"routes win over legacy", []Route{oncall}, legacy, GotifyMessage{AppID: 7}, []string{"oncall"}, false, true},
+		{"legacy match sends to all", []Route{oncall}, legacy, GotifyMessage{AppID: 3}, nil, true, true},
+		{"legacy filters unmatched", []Route{oncall}, legacy, GotifyMessage{AppID: 1}, nil, false, false},
+		{"legacy only", nil, legacy, GotifyMessage{AppID: 1}, nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := NewMessageRouter(tt.routes, tt.fallback).Resolve(tt.msg)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			var names []string
+			for _, r := range res.Routes {
+				names = append(names, r.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("routes = %v, want %v", names, tt.want)
+			}
+			if res.All != tt.all {
+				t.Errorf("all = %v, want %v", res.All, tt.all)
+			}
+		})
+	}
+}
+
+// TestConnectRejectedHandshake Gotify 拒绝握手（401）时返回 streamAuthError，不再重连
+func TestConnectRejectedHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.GotifyURL = srv.URL
+	c.ClientToken = "client-token"
+	p := newTestPlugin(t, &mockWeChat{}, c)
+
+	s := NewStreamListener(p)
+	err := s.connectAndListen()
+	var authErr *streamAuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("connectAndListen = %v, want streamAuthError", err)
+	}
+	if !strings.Contains(err.Error(), "401") {
+		t.Errorf("error %q does not mention the HTTP status", err)
+	}
+}
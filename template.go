@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateField 模板消息中的单个字段
+type TemplateField struct {
+	Value string `json:"value"`
+	Color string `json:"color,omitempty"`
+}
+
+// messageAttribute 返回 template_field_map 中引用的消息属性值，未知名称视为字面量
+func (c *Config) messageAttribute(source string, msg OutgoingMessage) string {
+	switch strings.ToLower(strings.TrimSpace(source)) {
+	case "title":
+		return msg.Title
+	case "message", "content":
+		return msg.Content
+	case "priority":
+		return strconv.Itoa(msg.Priority)
+	case "level":
+		return c.priorityLabel(msg.Priority)
+	case "date":
+		return c.formatDate(messageDate(msg))
+	case "appid":
+		if msg.AppID == 0 {
+			return ""
+		}
+		return strconv.FormatInt(msg.AppID, 10)
+	case "source":
+		if msg.AppID == 0 {
+			return ""
+		}
+		return c.appName(msg.AppID)
+	default:
+		return source
+	}
+}
+
+// messageDate 返回消息时间，未设置时使用当前时间
+func messageDate(msg OutgoingMessage) time.Time {
+	if msg.Date.IsZero() {
+		return time.Now()
+	}
+	return msg.Date
+}
+
+// buildTemplateData 构建模板消息的 data 字段
+func (c *Config) buildTemplateData(msg OutgoingMessage) map[string]TemplateField {
+	data := make(map[string]TemplateField)
+
+	if len(c.TemplateFieldMap) > 0 {
+		for field, source := range c.TemplateFieldMap {
+			data[field] = TemplateField{Value: c.messageAttribute(source, msg)}
+		}
+	} else {
+		data["title"] = TemplateField{Value: msg.Title}
+		data["content"] = TemplateField{Value: msg.Content}
+	}
+
+	if c.DateField != "" {
+		data[c.DateField] = TemplateField{Value: c.formatDate(messageDate(msg))}
+	}
+
+	if c.SourceField != "" && msg.AppID != 0 {
+		data[c.SourceField] = TemplateField{Value: c.appName(msg.AppID)}
+	}
+
+	if c.LevelField != "" {
+		data[c.LevelField] = TemplateField{Value: c.priorityLabel(msg.Priority)}
+	}
+
+	for field, value := range msg.Fields {
+		data[field] = TemplateField{Value: value}
+	}
+
+	// 标题和内容已在 prepareText 中截断；extras 和 template_field_map 带来的字段同样不能超过上限
+	for field, v := range data {
+		v.Value = truncateRunes(v.Value, c.MaxContentRunes)
+		data[field] = v
+	}
+
+	if color := c.fieldColor(msg.Priority); color != "" {
+		for field, v := range data {
+			v.Color = color
+			data[field] = v
+		}
+	}
+
+	return data
+}
+
+// defaultExtrasFieldsKey 默认读取模板字段值的 extras 键
+const defaultExtrasFieldsKey = "wechat::fields"
+
+// extrasFields 读取 extras[key] 中的模板字段值，忽略空字段名和非字符串的值
+func extrasFields(extras map[string]interface{}, key string) (map[string]string, []string) {
+	if key == "" {
+		return nil, nil
+	}
+	raw, ok := extras[key].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	fields := make(map[string]string, len(raw))
+	var ignored []string
+	for field, v := range raw {
+		s, ok := v.(string)
+		if strings.TrimSpace(field) == "" || !ok {
+			ignored = append(ignored, field)
+			continue
+		}
+		fields[field] = s
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	return fields, ignored
+}
+
+// fieldColor 返回字段颜色：命中阈值最高的 priority_colors 规则优先，否则使用 field_color
+func (c *Config) fieldColor(priority int) string {
+	color, best := c.FieldColor, -1
+	for _, pc := range c.PriorityColors {
+		if priority >= pc.MinPriority && pc.MinPriority > best {
+			color, best = pc.Color, pc.MinPriority
+		}
+	}
+	return color
+}
+
+// messageTemplateData message_template 可引用的消息字段
+type messageTemplateData struct {
+	Title    string
+	Message  string
+	Priority int
+	AppID    int64
+	Date     time.Time
+	Extras   map[string]interface{}
+}
+
+// parseMessageTemplate 解析 message_template，为空时返回 nil
+func parseMessageTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("message_template").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message_template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderContent 用 message_template 渲染消息内容，未配置模板时返回原始内容
+func (c *Config) renderContent(msg GotifyMessage, date time.Time) (string, error) {
+	if c.messageTemplate == nil {
+		return msg.Message, nil
+	}
+	var b strings.Builder
+	err := c.messageTemplate.Execute(&b, messageTemplateData{
+		Title:    msg.Title,
+		Message:  msg.Message,
+		Priority: msg.Priority,
+		AppID:    msg.AppID,
+		Date:     date.In(c.loc()),
+		Extras:   msg.Extras,
+	})
+	if err != nil {
+		return msg.Message, fmt.Errorf("failed to render message_template: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeText 对文本做 Unicode NFC 规范化，可选去除组合附加符号（如重音符）
+func normalizeText(s string, stripMarks bool) string {
+	if !stripMarks {
+		return norm.NFC.String(s)
+	}
+
+	// 先分解，去掉组合符号后再组合，确保预组合字符中的附加符号也被去除
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		return norm.NFC.String(s)
+	}
+	return out
+}
+
+// ellipsis 截断文本时追加的省略号
+const ellipsis = "…"
+
+// truncateRunes 将文本截断到最多 max 个字符（按 rune 计算，含省略号），max 为 0 表示不截断
+func truncateRunes(s string, max int) string {
+	if max <= 0 {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	if max == 1 {
+		return ellipsis
+	}
+	return string(r[:max-1]) + ellipsis
+}
+
+// prepareText 按配置规范化并截断标题和内容
+func (c *Config) prepareText(msg OutgoingMessage) OutgoingMessage {
+	if c.NormalizeUnicode {
+		msg.Title = normalizeText(msg.Title, c.StripCombiningMarks)
+		msg.Content = normalizeText(msg.Content, c.StripCombiningMarks)
+	}
+	// 超长字段会导致整条推送失败，截断后再发送；前缀和附加信息计入内容长度，只截断原始内容
+	msg.Title = truncateRunes(msg.Title, c.MaxTitleRunes)
+	footer := c.contentFooter(msg) + c.ContentSuffix
+	if c.MaxContentRunes <= 0 {
+		msg.Content = c.ContentPrefix + msg.Content + footer
+		return msg
+	}
+	limit := c.MaxContentRunes - utf8.RuneCountInString(c.ContentPrefix+footer)
+	if limit < 1 {
+		// 校验时已按最长的附加信息预留空间，这里只是兜底，保证不超过上限
+		msg.Content = truncateRunes(c.ContentPrefix+footer, c.MaxContentRunes)
+		return msg
+	}
+	msg.Content = c.ContentPrefix + truncateRunes(msg.Content, limit) + footer
+	return msg
+}
+
+// footerProbeDate 估算时间行最大长度用的时间：英文月份和星期名最长、各字段均为两位数
+var footerProbeDate = time.Date(2000, time.September, 27, 23, 59, 59, 999999999, time.UTC)
+
+// reservedContentRunes 返回 max_content_runes 中需要为前缀、后缀和优先级/时间行预留的最大字符数
+func (c *Config) reservedContentRunes() int {
+	footer := 0
+	for _, priority := range []int{0, 5, 10} {
+		msg := OutgoingMessage{Priority: priority, Date: footerProbeDate.In(c.loc())}
+		footer = max(footer, utf8.RuneCountInString(c.contentFooter(msg)))
+	}
+	return utf8.RuneCountInString(c.ContentPrefix+c.ContentSuffix) + footer
+}
+
+// contentFooter 返回追加在内容末尾的优先级和时间信息
+func (c *Config) contentFooter(msg OutgoingMessage) string {
+	footer := ""
+	if c.IncludePriority {
+		footer += c.text("footer_priority", c.priorityLabel(msg.Priority), msg.Priority)
+	}
+	if c.IncludeTimestamp {
+		footer += c.text("footer_time", c.formatDate(messageDate(msg)))
+	}
+	return footer
+}
+
+var (
+	mdFenceRegex      = regexp.MustCompile("(?m)^\\s*```[^\\n]*\\n?")
+	mdImageRegex      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkRegex       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdHeaderRegex     = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	mdQuoteRegex      = regexp.MustCompile(`(?m)^\s{0,3}>\s?`)
+	mdListRegex       = regexp.MustCompile(`(?m)^(\s*)[-*+]\s+`)
+	mdRuleRegex       = regexp.MustCompile(`(?m)^\s{0,3}([-*_]\s*){3,}$`)
+	mdBoldRegex       = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdItalicRegex     = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:[^*_]*?\S)?)[*_]`)
+	mdStrikeRegex     = regexp.MustCompile(`~~(.+?)~~`)
+	mdInlineCodeRegex = regexp.MustCompile("`([^`]+)`")
+)
+
+// flattenMarkdown 将 markdown 转换为可读的纯文本：去掉标题、强调、代码块标记，链接保留文字和地址
+func flattenMarkdown(s string) string {
+	s = mdFenceRegex.ReplaceAllString(s, "")
+	s = mdInlineCodeRegex.ReplaceAllString(s, "$1")
+	s = mdImageRegex.ReplaceAllString(s, "$1")
+	s = mdLinkRegex.ReplaceAllString(s, "$1 ($2)")
+	s = mdRuleRegex.ReplaceAllString(s, "")
+	s = mdHeaderRegex.ReplaceAllString(s, "")
+	s = mdQuoteRegex.ReplaceAllString(s, "")
+	s = mdListRegex.ReplaceAllString(s, "$1• ")
+	s = mdBoldRegex.ReplaceAllString(s, "$2")
+	s = mdStrikeRegex.ReplaceAllString(s, "$1")
+	s = mdItalicRegex.ReplaceAllString(s, "$1$2")
+	return strings.TrimSpace(s)
+}
+
+// extrasImageURL 返回 Gotify 消息 extras 中 client::notification.bigImageUrl 声明的图片地址，
+// 未设置或不是 http(s) 地址时返回空字符串
+func extrasImageURL(extras map[string]interface{}) string {
+	notification, ok := extras["client::notification"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	raw, _ := notification["bigImageUrl"].(string)
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return raw
+}
+
+// Gotify 消息的内容类型（extras client::display.contentType）
+const (
+	contentTypePlain    = "text/plain"
+	contentTypeMarkdown = "text/markdown"
+)
+
+// messageContentType 返回 Gotify 消息 extras 声明的内容类型；未声明或无法识别时按 text/plain 处理
+func messageContentType(extras map[string]interface{}) string {
+	display, ok := extras["client::display"].(map[string]interface{})
+	if !ok {
+		return contentTypePlain
+	}
+	contentType, _ := display["contentType"].(string)
+	if strings.TrimSpace(strings.ToLower(contentType)) == contentTypeMarkdown {
+		return contentTypeMarkdown
+	}
+	return contentTypePlain
+}
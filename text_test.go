@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// longCJK 返回 n 个中文字符组成的字符串
+func longCJK(n int) string {
+	return string([]rune(strings.Repeat("微信推送测试", n/6+1))[:n])
+}
+
+func TestTruncateRunesCJK(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"中文标题", 0, "中文标题"},
+		{"中文标题", 4, "中文标题"},
+		{"中文标题", 3, "中文…"},
+		{"中文标题", 1, "…"},
+		{"a中b文", 3, "a中…"},
+	}
+	for _, tt := range tests {
+		if got := truncateRunes(tt.in, tt.max); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareTextLongCJK(t *testing.T) {
+	c := testConfig()
+	c.MaxTitleRunes = 20
+	c.MaxContentRunes = 100
+	c.ContentPrefix = "【告警】"
+	c.ContentSuffix = "——来自 Gotify"
+	c.IncludePriority = true
+	c.IncludeTimestamp = true
+
+	msg := c.prepareText(OutgoingMessage{
+		Title:    longCJK(500),
+		Content:  longCJK(5000),
+		Priority: 8,
+		Date:     time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC),
+	})
+
+	for name, s := range map[string]string{"title": msg.Title, "content": msg.Content} {
+		if !utf8.ValidString(s) {
+			t.Errorf("%s is not valid UTF-8 after truncation", name)
+		}
+	}
+	if n := utf8.RuneCountInString(msg.Title); n != c.MaxTitleRunes {
+		t.Errorf("title has %d runes, want %d", n, c.MaxTitleRunes)
+	}
+	if n := utf8.RuneCountInString(msg.Content); n != c.MaxContentRunes {
+		t.Errorf("content has %d runes, want %d", n, c.MaxContentRunes)
+	}
+	if !strings.HasPrefix(msg.Content, c.ContentPrefix) || !strings.HasSuffix(msg.Content, c.ContentSuffix) {
+		t.Errorf("content lost prefix or suffix: %q", msg.Content)
+	}
+	if !strings.Contains(msg.Content, "…\n优先级: 高 (8)\n时间: 2024-03-01 08:00:00") {
+		t.Errorf("content footer missing or not after the ellipsis: %q", msg.Content)
+	}
+}
+
+func TestBuildTemplateDataTruncatesFields(t *testing.T) {
+	c := testConfig()
+	c.MaxContentRunes = 50
+	c.TemplateFieldMap = map[string]string{"first": "title", "remark": longCJK(300)}
+
+	data := c.buildTemplateData(OutgoingMessage{
+		Title:  "标题",
+		Fields: map[string]string{"keyword1": longCJK(300)},
+	})
+	for field, v := range data {
+		if n := utf8.RuneCountInString(v.Value); n > c.MaxContentRunes {
+			t.Errorf("field %s has %d runes, want at most %d", field, n, c.MaxContentRunes)
+		}
+		if !utf8.ValidString(v.Value) {
+			t.Errorf("field %s is not valid UTF-8", field)
+		}
+	}
+	if data["first"].Value != "标题" {
+		t.Errorf("short field changed: %q", data["first"].Value)
+	}
+}
+
+func TestValidateRejectsNoRoomForContent(t *testing.T) {
+	p := &WeChatPlugin{}
+
+	c := testConfig()
+	c.MaxContentRunes = 30
+	c.ContentPrefix = longCJK(10)
+	c.IncludeTimestamp = true
+	c.IncludePriority = true
+	// 前缀 10 + 时间行 23 已超过 30
+	if err := p.ValidateAndSetConfig(c); err == nil || !strings.Contains(err.Error(), "max_content_runes") {
+		t.Errorf("expected max_content_runes error, got %v", err)
+	}
+
+	c = testConfig()
+	c.MaxContentRunes = 30
+	c.ContentPrefix = longCJK(10)
+	if err := p.ValidateAndSetConfig(c); err != nil {
+		t.Errorf("config with room left was rejected: %v", err)
+	}
+}
+
+func TestNormalizeTextComposesEquivalentForms(t *testing.T) {
+	tests := []struct {
+		name       string
+		decomposed string
+		composed   string
+	}{
+		{"latin accent", "Cafe\u0301 re\u0301sume\u0301", "Café résumé"},
+		{"hangul jamo", "\u1112\u1161\u11ab\u1100\u1173\u11af", "한글"},
+		{"japanese dakuten", "か\u3099き\u3099", "がぎ"},
+		{"mixed with chinese", "告警：se\u0301rveur 已恢复", "告警：sérveur 已恢复"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.decomposed == tt.composed {
+				t.Fatal("test input is already composed")
+			}
+			got, want := normalizeText(tt.decomposed, false), normalizeText(tt.composed, false)
+			if got != want {
+				t.Errorf("normalizeText(%q) = %q, normalizeText(%q) = %q", tt.decomposed, got, tt.composed, want)
+			}
+			if got != tt.composed {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.decomposed, got, tt.composed)
+			}
+		})
+	}
+}
+
+func TestNormalizeTextStripMarks(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Café", "Cafe"},
+		{"Cafe\u0301", "Cafe"},
+		{"が", "か"},
+		{"微信推送", "微信推送"},
+		{"한글", "한글"},
+	}
+	for _, tt := range tests {
+		if got := normalizeText(tt.in, true); got != tt.want {
+			t.Errorf("normalizeText(%q, true) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,19 +27,112 @@ type WeChatPlugin struct {
 	storage    plugin.StorageHandler
 	config     *Config
 	basePath   string
-	tokenCache *TokenCache
 	msgMgr     *MessageManager
 	stream     *StreamListener
 	mu         sync.RWMutex
+
+	// configMu 只保护 config 指针的替换，持有 p.mu 时也可获取，见 configSnapshot
+	configMu sync.RWMutex
+
+	// Enable 或 /reload 时生效的配置，/reload 据此判断哪些配置发生了变化
+	appliedConfig *Config
+
+	storageMu           sync.Mutex
+	statsRestored       bool
+	statsFlushedVersion atomic.Int64
+
+	// 消息流转发限额：启用后累计转发数，超过 ForwardLimit 时暂停
+	forwarded atomic.Int64
+	paused    atomic.Bool
+
+	// 是否以 JSON 行格式输出日志，随配置更新
+	jsonLogs atomic.Bool
+
+	inFlight atomic.Int64 // 正在进行中的微信发送数
+
+	// 进行中的 sendToMultiple 调用，Disable 时等待其完成；closing 后拒绝新的发送
+	// runCtx 在 Enable 时创建、Disable 时取消，用于中断挂起的微信接口请求；closing 和 runCtx 受 sendMu 保护
+	sends     sync.WaitGroup
+	closing   bool
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	sendMu    sync.Mutex
+
+	// 调用微信接口共用的 HTTP 客户端，随配置重建；http.Client 可被多个 goroutine 并发使用
+	// 与 limiter 一样通过原子指针替换，发送路径无需持有 mu
+	httpClient atomic.Pointer[http.Client]
+
+	quota   dailyQuota                  // 每日发送配额统计
+	limiter atomic.Pointer[sendLimiter] // 微信 API 调用限流
+
+	// 按 AppID 缓存的 access_token，每个公众号账号一份，受 tokenMu 保护
+	tokenCaches map[string]*TokenCache
+	tokenMu     sync.Mutex
+
+	// 金丝雀检测：最近一次结果（canaryResult）及是否处于降级状态
+	canary   atomic.Value
+	degraded atomic.Bool
+
+	// 后台任务（如统计持久化），在 Disable 时停止
+	bgStop chan struct{}
+	bgWG   sync.WaitGroup
+	// 后台刷新 token 的停止信号，未运行时为 nil；随 backend 切换单独启停，受 mu 保护
+	refreshStop chan struct{}
 }
 
 // MessageManager 消息管理器，负责消息统计、通知和错误上报
 type MessageManager struct {
-	handler    plugin.MessageHandler
-	totalSent  atomic.Int64
-	totalFail  atomic.Int64
-	lastSentAt atomic.Value // time.Time
-	lastError  atomic.Value // string
+	handler       plugin.MessageHandler
+	totalSent     atomic.Int64
+	totalFail     atomic.Int64
+	totalFiltered atomic.Int64
+	escalations   atomic.Int64 // 改发给备用接收者的次数
+	lastSentAt    atomic.Value // time.Time
+	lastError     atomic.Value // ErrorRecord
+	lastErrorMu   sync.Mutex   // 串行化 lastError 的读-改-写
+	version       atomic.Int64 // 统计每次变更时递增，用于判断是否需要持久化
+
+	// 按接收者名称统计的发送成功、失败和被优先级下限过滤的次数，受 recipientMu 保护
+	sentBy      map[string]int64
+	failedBy    map[string]int64
+	filtered    map[string]int64
+	recipientMu sync.Mutex
+
+	history  deliveryHistory // 最近的投递记录
+	errcodes errcodeHistory  // 最近一小时的微信错误码
+
+	// 插件发出的 Gotify 通知的优先级，随配置更新
+	deliveryPriority atomic.Int64
+	errorPriority    atomic.Int64
+	statusPriority   atomic.Int64
+
+	// 自定义的通知模板，随配置更新，为空时使用默认文案
+	templates atomic.Pointer[notifyTemplates]
+	language  atomic.Value // string，通知使用的语言
+}
+
+// ErrorRecord 最近的错误，连续相同的错误会合并计数
+type ErrorRecord struct {
+	Message   string
+	Count     int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// OutgoingMessage 待推送到微信的消息
+type OutgoingMessage struct {
+	Title    string
+	Content  string
+	Priority int
+	Date     time.Time
+	AppID    int64             // 来源 Gotify 应用，webhook 发送时为 0
+	Account  string            // 发送使用的公众号账号名称，为空表示默认账号
+	ImageURL string            // 消息附带的图片地址，仅群机器人后端以图文消息发送
+	Fields   map[string]string // 消息 extras 中指定的模板字段值，覆盖默认字段
+
+	// BypassFloor 跳过接收者的 min_priority 下限，用于 /test 和按名称指定接收者的 /send：
+	// 下限用于过滤路由转发的低优先级消息，不应拦截明确指定目标的发送
+	BypassFloor bool
 }
 
 type TokenCache struct {
@@ -53,10 +149,32 @@ type AccessTokenResponse struct {
 }
 
 type TemplateMessageRequest struct {
-	ToUser     string                 `json:"touser"`
-	TemplateID string                 `json:"template_id"`
-	URL        string                 `json:"url"`
-	Data       map[string]interface{} `json:"data"`
+	ToUser      string                   `json:"touser"`
+	TemplateID  string                   `json:"template_id"`
+	URL         string                   `json:"url,omitempty"`
+	TopColor    string                   `json:"topcolor,omitempty"`
+	MiniProgram *TemplateMiniProgram     `json:"miniprogram,omitempty"`
+	Data        map[string]TemplateField `json:"data"`
+}
+
+// SubscribeMessageRequest 订阅通知请求，data 中的字段只有 value
+type SubscribeMessageRequest struct {
+	ToUser      string                    `json:"touser"`
+	TemplateID  string                    `json:"template_id"`
+	Page        string                    `json:"page,omitempty"`
+	MiniProgram *TemplateMiniProgram      `json:"miniprogram,omitempty"`
+	Data        map[string]SubscribeField `json:"data"`
+}
+
+// SubscribeField 订阅通知中的单个字段
+type SubscribeField struct {
+	Value string `json:"value"`
+}
+
+// TemplateMiniProgram 点击模板消息后打开的小程序
+type TemplateMiniProgram struct {
+	AppID    string `json:"appid"`
+	PagePath string `json:"pagepath,omitempty"`
 }
 
 type WechatAPIResponse struct {
@@ -65,20 +183,61 @@ type WechatAPIResponse struct {
 	Msgid   int64  `json:"msgid"`
 }
 
+// 插件 Gotify 通知的默认优先级
+const (
+	defaultDeliveryNotifyPriority = 1
+	defaultErrorNotifyPriority    = 5
+	defaultStatusNotifyPriority   = 2
+)
+
 // NewMessageManager 创建消息管理器
 func NewMessageManager(h plugin.MessageHandler) *MessageManager {
-	return &MessageManager{handler: h}
+	m := &MessageManager{
+		handler:  h,
+		sentBy:   make(map[string]int64),
+		failedBy: make(map[string]int64),
+		filtered: make(map[string]int64),
+	}
+	m.SetNotifyPriorities(defaultDeliveryNotifyPriority, defaultErrorNotifyPriority, defaultStatusNotifyPriority)
+	return m
+}
+
+// SetNotifyPriorities 设置投递成功、错误告警和状态变更通知的优先级
+func (m *MessageManager) SetNotifyPriorities(delivery, errorPriority, status int) {
+	if m == nil {
+		return
+	}
+	m.deliveryPriority.Store(int64(delivery))
+	m.errorPriority.Store(int64(errorPriority))
+	m.statusPriority.Store(int64(status))
+}
+
+// selfMessageExtrasKey 插件自身通知的 extras 标记，消息流收到带此标记的消息时不再转发，避免循环
+const selfMessageExtrasKey = "wechat::origin"
+
+// send 发送通知到 Gotify，并打上插件自身来源标记
+func (m *MessageManager) send(msg plugin.Message) {
+	if msg.Extras == nil {
+		msg.Extras = make(map[string]interface{})
+	}
+	msg.Extras[selfMessageExtrasKey] = "gotify-wechat-plugin"
+	_ = m.handler.SendMessage(msg)
 }
 
-// NotifyStatus 发送插件状态变更通知到 Gotify
-func (m *MessageManager) NotifyStatus(userName, status string) {
+// NotifyStatus 发送插件启用或停用的通知到 Gotify
+func (m *MessageManager) NotifyStatus(userName string, enabled bool) {
 	if m == nil || m.handler == nil {
 		return
 	}
-	_ = m.handler.SendMessage(plugin.Message{
-		Title:    "微信推送插件状态变更",
-		Message:  fmt.Sprintf("用户 %s 的微信推送插件已%s", userName, status),
-		Priority: 2,
+	data := statusNotifyData{User: userName, Status: m.text("notify_disabled"), Enabled: enabled}
+	if enabled {
+		data.Status = m.text("notify_enabled")
+	}
+	title, msg := m.renderNotify(notifyStatus, data)
+	m.send(plugin.Message{
+		Title:    title,
+		Message:  msg,
+		Priority: int(m.statusPriority.Load()),
 	})
 }
 
@@ -87,32 +246,84 @@ func (m *MessageManager) NotifyDelivery(title string, successCount, totalCount i
 	if m == nil || m.handler == nil {
 		return
 	}
-	msg := fmt.Sprintf("消息「%s」已成功推送至 %d/%d 个接收者", title, successCount, totalCount)
-	_ = m.handler.SendMessage(plugin.Message{
-		Title:    "微信推送成功",
+	notifyTitle, msg := m.renderNotify(notifyDelivery, deliveryNotifyData{Title: title, Success: successCount, Total: totalCount})
+	m.send(plugin.Message{
+		Title:    notifyTitle,
 		Message:  msg,
-		Priority: 1,
+		Priority: int(m.deliveryPriority.Load()),
 	})
 }
 
-// NotifyError 发送结构化错误通知到 Gotify
+// NotifyError 发送结构化错误通知到 Gotify；最近错误按默认文案记录，不受自定义模板影响
 func (m *MessageManager) NotifyError(title string, errs []error, totalCount int) {
 	if m == nil || m.handler == nil {
 		return
 	}
-	errMsgs := make([]string, len(errs))
+	data := errorNotifyData{Title: title, Failed: len(errs), Total: totalCount, Errors: make([]string, len(errs))}
 	for i, e := range errs {
-		errMsgs[i] = fmt.Sprintf("  - %s", e.Error())
+		data.Errors[i] = e.Error() + errcodeHint(m.lang(), e)
+	}
+
+	def := defaultNotifyTemplates[m.lang()][notifyError].message
+	m.recordError(executeNotify(def, def, data))
+
+	notifyTitle, msg := m.renderNotify(notifyError, data)
+	m.send(plugin.Message{
+		Title:    notifyTitle,
+		Message:  msg,
+		Priority: int(m.errorPriority.Load()),
+	})
+}
+
+// NotifyPaused 发送转发限额触发暂停的通知到 Gotify
+func (m *MessageManager) NotifyPaused(limit int64) {
+	if m == nil || m.handler == nil {
+		return
+	}
+	m.send(plugin.Message{
+		Title:    m.text("paused_title"),
+		Message:  m.text("paused_message", limit),
+		Priority: int(m.errorPriority.Load()),
+	})
+}
+
+// NotifyCanaryFailure 发送金丝雀检测失败的告警到 Gotify
+func (m *MessageManager) NotifyCanaryFailure(recipient string, err error) {
+	if m == nil || m.handler == nil {
+		return
 	}
-	msg := fmt.Sprintf("消息「%s」推送失败 %d/%d:\n%s",
-		title, len(errs), totalCount, strings.Join(errMsgs, "\n"))
+	m.send(plugin.Message{
+		Title:    m.text("canary_title"),
+		Message:  m.text("canary_message", recipient, err.Error()),
+		Priority: int(m.errorPriority.Load()),
+	})
+}
 
-	m.lastError.Store(msg)
+// NotifyStreamAuthFailed 发送消息流 client_token 被拒绝的告警到 Gotify
+func (m *MessageManager) NotifyStreamAuthFailed(err error) {
+	if m == nil || m.handler == nil {
+		return
+	}
+	m.send(plugin.Message{
+		Title:    m.text("stream_auth_title"),
+		Message:  m.text("stream_auth_message", err.Error()),
+		Priority: int(m.errorPriority.Load()),
+	})
+}
 
-	_ = m.handler.SendMessage(plugin.Message{
-		Title:    "微信推送失败",
+// NotifyQuotaWarning 发送每日配额预警通知到 Gotify
+func (m *MessageManager) NotifyQuotaWarning(appID string, count, warn, hard int64) {
+	if m == nil || m.handler == nil {
+		return
+	}
+	msg := m.text("quota_message", appID, count, warn)
+	if hard > 0 {
+		msg += m.text("quota_message_hard", hard)
+	}
+	m.send(plugin.Message{
+		Title:    m.text("quota_title"),
 		Message:  msg,
-		Priority: 5,
+		Priority: int(m.errorPriority.Load()),
 	})
 }
 
@@ -123,6 +334,7 @@ func (m *MessageManager) RecordSuccess(count int) {
 	}
 	m.totalSent.Add(int64(count))
 	m.lastSentAt.Store(time.Now())
+	m.version.Add(1)
 }
 
 // RecordFailure 记录发送失败
@@ -131,12 +343,126 @@ func (m *MessageManager) RecordFailure(count int) {
 		return
 	}
 	m.totalFail.Add(int64(count))
+	m.version.Add(1)
+}
+
+// RecordEscalation 记录一次改发给备用接收者
+func (m *MessageManager) RecordEscalation() {
+	if m == nil {
+		return
+	}
+	m.escalations.Add(1)
+	m.version.Add(1)
+}
+
+// Escalations 返回改发给备用接收者的次数
+func (m *MessageManager) Escalations() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.escalations.Load()
+}
+
+// RecordRecipient 记录发送给单个接收者的结果
+func (m *MessageManager) RecordRecipient(recipient string, success bool) {
+	if m == nil {
+		return
+	}
+	m.recipientMu.Lock()
+	if success {
+		m.sentBy[recipient]++
+	} else {
+		m.failedBy[recipient]++
+	}
+	m.recipientMu.Unlock()
+	m.version.Add(1)
+}
+
+// RecipientStats 单个接收者的发送统计
+type RecipientStats struct {
+	Sent     int64 `json:"sent"`
+	Failed   int64 `json:"failed"`
+	Filtered int64 `json:"filtered"`
+}
+
+// RecipientStats 返回按接收者名称的发送统计
+func (m *MessageManager) RecipientStats() map[string]RecipientStats {
+	if m == nil {
+		return nil
+	}
+	m.recipientMu.Lock()
+	defer m.recipientMu.Unlock()
+	stats := make(map[string]RecipientStats)
+	for name, n := range m.sentBy {
+		s := stats[name]
+		s.Sent = n
+		stats[name] = s
+	}
+	for name, n := range m.failedBy {
+		s := stats[name]
+		s.Failed = n
+		stats[name] = s
+	}
+	for name, n := range m.filtered {
+		s := stats[name]
+		s.Filtered = n
+		stats[name] = s
+	}
+	return stats
+}
+
+// copyCounts 复制计数 map
+func copyCounts(src map[string]int64) map[string]int64 {
+	dst := make(map[string]int64, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// RecordFiltered 记录因接收者优先级下限而跳过的推送
+func (m *MessageManager) RecordFiltered(recipient string) {
+	if m == nil {
+		return
+	}
+	m.totalFiltered.Add(1)
+	m.recipientMu.Lock()
+	m.filtered[recipient]++
+	m.recipientMu.Unlock()
+	m.version.Add(1)
+}
+
+// Filtered 返回被过滤的推送总数及按接收者的明细
+func (m *MessageManager) Filtered() (total int64, byRecipient map[string]int64) {
+	if m == nil {
+		return 0, nil
+	}
+	m.recipientMu.Lock()
+	defer m.recipientMu.Unlock()
+	return m.totalFiltered.Load(), copyCounts(m.filtered)
+}
+
+// recordError 记录最近的错误，与上一条相同时累加计数并保留首次出现时间
+func (m *MessageManager) recordError(msg string) {
+	m.lastErrorMu.Lock()
+	defer m.lastErrorMu.Unlock()
+
+	now := time.Now()
+	rec := ErrorRecord{Message: msg, Count: 1, FirstSeen: now, LastSeen: now}
+	if v := m.lastError.Load(); v != nil {
+		if prev := v.(ErrorRecord); prev.Message == msg {
+			rec.Count = prev.Count + 1
+			rec.FirstSeen = prev.FirstSeen
+		}
+	}
+	m.lastError.Store(rec)
+	m.version.Add(1)
 }
 
 // Stats 返回消息统计信息
-func (m *MessageManager) Stats() (sent, failed int64, lastSent time.Time, lastErr string) {
+func (m *MessageManager) Stats() (sent, failed int64, lastSent time.Time, lastErr ErrorRecord) {
 	if m == nil {
-		return 0, 0, time.Time{}, ""
+		return 0, 0, time.Time{}, ErrorRecord{}
 	}
 	sent = m.totalSent.Load()
 	failed = m.totalFail.Load()
@@ -144,11 +470,116 @@ func (m *MessageManager) Stats() (sent, failed int64, lastSent time.Time, lastEr
 		lastSent = v.(time.Time)
 	}
 	if v := m.lastError.Load(); v != nil {
-		lastErr = v.(string)
+		lastErr = v.(ErrorRecord)
 	}
 	return
 }
 
+// Version 返回统计的变更版本号
+func (m *MessageManager) Version() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.version.Load()
+}
+
+// Snapshot 返回当前统计的快照，用于持久化
+func (m *MessageManager) Snapshot() persistedStats {
+	sent, failed, lastSent, lastErr := m.Stats()
+	filtered, byRecipient := m.Filtered()
+	s := persistedStats{
+		TotalSent:      sent,
+		TotalFail:      failed,
+		TotalFiltered:  filtered,
+		Escalations:    m.Escalations(),
+		LastSentAt:     lastSent,
+		LastError:      lastErr.Message,
+		LastErrorCount: lastErr.Count,
+		LastErrorFirst: lastErr.FirstSeen,
+		LastErrorLast:  lastErr.LastSeen,
+		Filtered:       byRecipient,
+	}
+	m.recipientMu.Lock()
+	s.Sent = copyCounts(m.sentBy)
+	s.Failed = copyCounts(m.failedBy)
+	m.recipientMu.Unlock()
+	return s
+}
+
+// Restore 从持久化快照恢复统计
+func (m *MessageManager) Restore(s persistedStats) {
+	if m == nil {
+		return
+	}
+	m.totalSent.Store(s.TotalSent)
+	m.totalFail.Store(s.TotalFail)
+	m.totalFiltered.Store(s.TotalFiltered)
+	m.escalations.Store(s.Escalations)
+	if !s.LastSentAt.IsZero() {
+		m.lastSentAt.Store(s.LastSentAt)
+	}
+	if s.LastError != "" {
+		count := s.LastErrorCount
+		if count < 1 {
+			count = 1
+		}
+		m.lastError.Store(ErrorRecord{
+			Message:   s.LastError,
+			Count:     count,
+			FirstSeen: s.LastErrorFirst,
+			LastSeen:  s.LastErrorLast,
+		})
+	}
+	m.recipientMu.Lock()
+	for name, n := range s.Filtered {
+		m.filtered[name] = n
+	}
+	for name, n := range s.Sent {
+		m.sentBy[name] = n
+	}
+	for name, n := range s.Failed {
+		m.failedBy[name] = n
+	}
+	m.recipientMu.Unlock()
+}
+
+// Reset 清零统计并清除最近发送时间和最近错误，返回清零前的统计
+func (m *MessageManager) Reset() persistedStats {
+	if m == nil {
+		return persistedStats{}
+	}
+	m.lastErrorMu.Lock()
+	defer m.lastErrorMu.Unlock()
+	m.recipientMu.Lock()
+	defer m.recipientMu.Unlock()
+
+	prev := persistedStats{
+		TotalSent:     m.totalSent.Swap(0),
+		TotalFail:     m.totalFail.Swap(0),
+		TotalFiltered: m.totalFiltered.Swap(0),
+		Escalations:   m.escalations.Swap(0),
+		Filtered:      m.filtered,
+		Sent:          m.sentBy,
+		Failed:        m.failedBy,
+	}
+	if v := m.lastSentAt.Swap(time.Time{}); v != nil {
+		prev.LastSentAt = v.(time.Time)
+	}
+	if v := m.lastError.Swap(ErrorRecord{}); v != nil {
+		rec := v.(ErrorRecord)
+		prev.LastError = rec.Message
+		prev.LastErrorCount = rec.Count
+		prev.LastErrorFirst = rec.FirstSeen
+		prev.LastErrorLast = rec.LastSeen
+	}
+	m.filtered = make(map[string]int64)
+	m.sentBy = make(map[string]int64)
+	m.failedBy = make(map[string]int64)
+	m.errcodes.reset()
+	m.version.Add(1)
+	return prev
+}
+
 func (p *WeChatPlugin) Enable() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -158,33 +589,79 @@ func (p *WeChatPlugin) Enable() error {
 	}
 
 	p.enabled = true
-	p.tokenCache = &TokenCache{}
+	p.sendMu.Lock()
+	p.closing = false
+	p.runCtx, p.cancelRun = context.WithCancel(context.Background())
+	p.sendMu.Unlock()
+	p.tokenMu.Lock()
+	p.tokenCaches = make(map[string]*TokenCache)
+	p.tokenMu.Unlock()
+	p.limiter.Store(newSendLimiter(p.config.MaxConcurrency, p.config.MinSendInterval))
+	p.forwarded.Store(0)
+	p.paused.Store(false)
+
+	// 恢复持久化的统计，并周期性写回
+	p.restoreStats()
+	p.bgStop = make(chan struct{})
+	if interval := p.config.StatsFlushInterval; interval > 0 {
+		stop := p.bgStop
+		p.bgWG.Add(1)
+		go func() {
+			defer p.bgWG.Done()
+			p.runStatsFlusher(interval, stop)
+		}()
+	}
+	p.degraded.Store(false)
+	if interval := p.config.CanaryInterval; interval > 0 {
+		stop := p.bgStop
+		p.bgWG.Add(1)
+		go func() {
+			defer p.bgWG.Done()
+			p.runCanary(interval, stop)
+		}()
+	}
+	p.syncTokenRefresherLocked()
 
 	// 启动 Gotify 消息流监听
-	if p.config.ClientToken != "" && len(p.config.MessageRoutes) > 0 {
-		p.stream = NewStreamListener(p)
-		go p.stream.Start()
-		log.Printf("[WeChat Plugin] Stream listener started with %d routes", len(p.config.MessageRoutes))
-	}
+	p.startStreamLocked()
+	p.appliedConfig = p.config
 
-	log.Printf("[WeChat Plugin] Enabled for user: %s", p.userCtx.Name)
-	p.msgMgr.NotifyStatus(p.userCtx.Name, "启用")
+	p.logEvent(levelInfo, "plugin_enabled", logFields{"user": p.userCtx.Name}, "Enabled for user: %s", p.userCtx.Name)
+	if !p.config.DisableSelfNotify {
+		p.msgMgr.NotifyStatus(p.userCtx.Name, true)
+	}
 	return nil
 }
 
 func (p *WeChatPlugin) Disable() error {
+	// 停止 Gotify 消息流监听（会发出合并缓冲中的消息）
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// 停止 Gotify 消息流监听
 	if p.stream != nil {
 		p.stream.Stop()
 		p.stream = nil
 	}
+	p.mu.Unlock()
+
+	// 拒绝新的发送并等待进行中的发送完成；等待期间不持有 p.mu，避免阻塞状态页面等读取
+	p.drainSends(sendDrainTimeout)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 停止后台任务并写入最终统计
+	p.stopTokenRefresherLocked()
+	if p.bgStop != nil {
+		close(p.bgStop)
+		p.bgWG.Wait()
+		p.bgStop = nil
+	}
+	p.flushStats()
 
 	p.enabled = false
-	log.Printf("[WeChat Plugin] Disabled for user: %s", p.userCtx.Name)
-	p.msgMgr.NotifyStatus(p.userCtx.Name, "停用")
+	p.logEvent(levelInfo, "plugin_disabled", logFields{"user": p.userCtx.Name}, "Disabled for user: %s", p.userCtx.Name)
+	if p.config == nil || !p.config.DisableSelfNotify {
+		p.msgMgr.NotifyStatus(p.userCtx.Name, false)
+	}
 	return nil
 }
 
@@ -197,21 +674,59 @@ func (p *WeChatPlugin) SetStorageHandler(h plugin.StorageHandler) {
 	p.storage = h
 }
 
+// configSnapshot 在读锁下返回当前配置，未配置时返回 nil
+// 配置发布后不再修改，ValidateAndSetConfig 只替换指针，调用方可以不持锁读取返回值。
+// 使用独立的 configMu 而不是 p.mu：Disable 和 /reload 持有 p.mu 停止消息流时，
+// 消息流协程和合并推送的发送仍需读取配置
+func (p *WeChatPlugin) configSnapshot() *Config {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return p.config
+}
+
+// endpointEnabled 按当前配置判断可关闭的端点（/send、/test）是否开启，未配置时视为开启
+// 路由在 RegisterWebhook 时总是注册，关闭的端点在处理请求时返回 404，开启后无需重启即可使用
+func (p *WeChatPlugin) endpointEnabled(path string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.config == nil {
+		return true
+	}
+	switch path {
+	case "/send":
+		return p.config.EnableSendEndpoint
+	case "/test":
+		return p.config.EnableTestEndpoint
+	}
+	return true
+}
+
 func (p *WeChatPlugin) RegisterWebhook(basePath string, router *gin.RouterGroup) {
 	p.basePath = basePath
 
-	// POST /send - 向后兼容旧接口，发送给所有接收者
+	// POST /send - 向后兼容旧接口，发送给所有接收者；关闭 enable_send_endpoint 时返回 404
 	router.POST("/send", func(c *gin.Context) {
+		if !p.endpointEnabled("/send") {
+			c.String(http.StatusNotFound, "404 page not found")
+			return
+		}
 		if !p.enabled {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"error": "plugin is disabled",
 			})
 			return
 		}
+		// 配置了 webhook_secret 时要求请求携带匹配的 X-Webhook-Secret，否则返回 401
+		if !p.checkWebhookSecret(c, false) {
+			return
+		}
 
 		var req struct {
-			Title   string `json:"title" binding:"required"`
-			Content string `json:"content" binding:"required"`
+			Title      string   `json:"title" binding:"required"`
+			Content    string   `json:"content" binding:"required"`
+			Recipients []string `json:"recipients"`
+			Priority   *int     `json:"priority"`
+			AppID      *int64   `json:"appid"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -221,11 +736,73 @@ func (p *WeChatPlugin) RegisterWebhook(basePath string, router *gin.RouterGroup)
 			return
 		}
 
-		openIDs := p.getAllOpenIDs()
-		errors := p.sendToMultiple(openIDs, req.Title, req.Content)
-		if len(errors) > 0 {
+		msg := OutgoingMessage{
+			Title:   req.Title,
+			Content: req.Content,
+			Date:    time.Now(),
+		}
+		if req.Priority != nil {
+			msg.Priority = *req.Priority
+		}
+		if req.AppID != nil {
+			msg.AppID = *req.AppID
+		}
+
+		// 默认发送给全部接收者；指定 recipients 时只发给这些接收者；
+		// 仅指定 priority 或 appid 时按 routes 路由，与消息流使用同一套规则
+		cfg := p.configSnapshot()
+		groups := []recipientGroup{{Recipients: p.getAllRecipients()}}
+		routed := len(req.Recipients) == 0 && (req.Priority != nil || req.AppID != nil) &&
+			(len(cfg.Routes) > 0 || len(cfg.MessageRoutes) > 0)
+		if len(req.Recipients) > 0 {
+			recipients, unknown := p.recipientsByName(req.Recipients)
+			if len(unknown) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   fmt.Sprintf("unknown recipients: %s", strings.Join(unknown, ", ")),
+					"unknown": unknown,
+				})
+				return
+			}
+			groups = []recipientGroup{{Recipients: recipients}}
+			msg.BypassFloor = true
+		} else if routed {
+			var ok bool
+			groups, ok = p.routeMessage(GotifyMessage{
+				AppID:    msg.AppID,
+				Title:    msg.Title,
+				Message:  msg.Content,
+				Priority: msg.Priority,
+			})
+			if !ok {
+				c.JSON(http.StatusOK, gin.H{
+					"success": true,
+					"message": "no route matched, message not sent",
+					"routed":  true,
+				})
+				return
+			}
+		}
+
+		// results 按接收者列出发送结果，调用方可只重发失败的接收者
+		var results sendResults
+		for _, g := range groups {
+			msg.Account = g.Account
+			results = append(results, p.sendToMultiple(g.Recipients, msg)...)
+		}
+		if failed := len(results.errors()); failed > 0 {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("failed to send to WeChat: %d/%d failed", len(errors), len(openIDs)),
+				"success": false,
+				"error":   fmt.Sprintf("failed to send to WeChat: %d/%d failed", failed, len(results)),
+				"msgids":  results.msgids(),
+				"results": results,
+			})
+			return
+		}
+		if len(results) > 0 && results.delivered() == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "all recipients filtered by min_priority, message not sent",
+				"results": results,
 			})
 			return
 		}
@@ -233,11 +810,17 @@ func (p *WeChatPlugin) RegisterWebhook(basePath string, router *gin.RouterGroup)
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "sent to WeChat successfully",
+			"msgids":  results.msgids(),
+			"results": results,
 		})
 	})
 
-	// GET /test - 测试连接，发送给所有接收者
+	// GET /test - 测试连接，发送给所有接收者；关闭 enable_test_endpoint 时返回 404
 	router.GET("/test", func(c *gin.Context) {
+		if !p.endpointEnabled("/test") {
+			c.String(http.StatusNotFound, "404 page not found")
+			return
+		}
 		if !p.enabled {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"error": "plugin is disabled",
@@ -245,256 +828,1326 @@ func (p *WeChatPlugin) RegisterWebhook(basePath string, router *gin.RouterGroup)
 			return
 		}
 
-		openIDs := p.getAllOpenIDs()
-		errors := p.sendToMultiple(openIDs, "Test Message", "This is a test message from Gotify WeChat Plugin")
-		if len(errors) > 0 {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("test failed: %d/%d failed", len(errors), len(openIDs)),
-			})
+		// 指定 recipient 时只发给该接收者，便于单独验证某个 OpenID
+		recipients := p.getAllRecipients()
+		name := c.Query("recipient")
+		if name != "" {
+			found, _ := p.recipientsByName([]string{name})
+			if len(found) == 0 {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": fmt.Sprintf("unknown recipient %q", name),
+				})
+				return
+			}
+			recipients = found
+		}
+
+		results := p.sendToMultiple(recipients, OutgoingMessage{
+			Title:   "Test Message",
+			Content: "This is a test message from Gotify WeChat Plugin",
+			Date:    time.Now(),
+			// 测试消息优先级为 0，跳过 min_priority 以免被过滤后仍返回成功
+			BypassFloor: true,
+		})
+		if failed := len(results.errors()); failed > 0 {
+			resp := gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("test failed: %d/%d failed", failed, len(results)),
+				"results": results,
+			}
+			if name != "" {
+				resp["recipient"] = name
+				resp["openid"] = maskString(recipients[0].OpenID)
+			}
+			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
+		resp := gin.H{
 			"success":    true,
 			"message":    "test message sent successfully",
-			"recipients": len(openIDs),
-		})
+			"recipients": len(recipients),
+			"msgids":     results.msgids(),
+			"results":    results,
+		}
+		if name != "" {
+			resp["recipient"] = name
+			resp["openid"] = maskString(recipients[0].OpenID)
+		}
+		c.JSON(http.StatusOK, resp)
 	})
-}
 
-func (p *WeChatPlugin) GetDisplay(location *url.URL) string {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
-	if p.config == nil {
-		return "Plugin not configured\n\nPlease configure the plugin with your WeChat credentials."
-	}
-
-	base := p.basePath
-	if !strings.HasSuffix(base, "/") {
-		base += "/"
-	}
-	webhookURL := &url.URL{Path: base}
-	if location != nil {
-		webhookURL.Scheme = location.Scheme
-		webhookURL.Host = location.Host
-	}
+	// POST /resume - 解除转发限额触发的暂停，并重新计数
+	router.POST("/resume", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
 
-	sendURL := webhookURL.ResolveReference(&url.URL{Path: "send"})
-	testURL := webhookURL.ResolveReference(&url.URL{Path: "test"})
+		wasPaused := p.paused.Load()
+		p.forwarded.Store(0)
+		p.paused.Store(false)
+		p.logEvent(levelInfo, "forwarding_resumed", logFields{"user": p.userCtx.Name}, "Forwarding resumed for user: %s", p.userCtx.Name)
 
-	status := "Disabled"
-	if p.enabled {
-		status = "Enabled"
-	}
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"was_paused": wasPaused,
+		})
+	})
 
-	// 构建接收者列表
-	recipientInfo := ""
-	if len(p.config.Recipients) > 0 {
-		recipientInfo = "\n### Recipients\n"
-		for _, r := range p.config.Recipients {
-			recipientInfo += fmt.Sprintf("- **%s:** %s\n", r.Name, maskString(r.OpenID))
+	// POST /reload - 重新校验并应用当前配置，尽量保留消息流连接
+	router.POST("/reload", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+		if !p.checkWebhookSecret(c, false) {
+			return
 		}
-	} else if p.config.OpenID != "" {
-		recipientInfo = fmt.Sprintf("\n### Recipient\n- **OpenID:** %s\n", maskString(p.config.OpenID))
-	}
 
-	// 获取消息统计
-	sent, failed, lastSent, lastErr := p.msgMgr.Stats()
-	lastSentStr := "N/A"
-	if !lastSent.IsZero() {
-		lastSentStr = lastSent.Format("2006-01-02 15:04:05")
-	}
-	lastErrInfo := ""
-	if lastErr != "" {
-		lastErrInfo = fmt.Sprintf("- **Last Error:** %s\n", lastErr)
-	}
+		res, err := p.reload()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid config: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"changed": res.Changed,
+			"stream":  res.Stream,
+		})
+	})
 
-	// 构建 Stream 状态
-	streamInfo := ""
-	if len(p.config.MessageRoutes) > 0 {
-		streamStatus := "Disconnected"
-		if p.stream != nil && p.stream.Connected() {
-			streamStatus = "Connected"
+	// POST /forward/:id - 通过 REST API 获取指定 ID 的 Gotify 消息并按路由重新转发
+	// 不受静默时段、转发限额和合并推送影响，便于补发单条漏发的消息
+	router.POST("/forward/:id", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
 		}
-		streamInfo = fmt.Sprintf("\n## Message Stream\n- **Status:** %s\n- **Routes:**\n", streamStatus)
-		for _, route := range p.config.MessageRoutes {
-			streamInfo += fmt.Sprintf("  - `%s`\n", route.Path)
+		if !p.checkWebhookSecret(c, false) {
+			return
 		}
-	}
-
-	return fmt.Sprintf(`# WeChat Template Message Pusher
-
-**Status:** %s
-
-## Configuration
-- **AppID:** %s
-- **Template ID:** %s
-%s
-## Statistics
-- **Total Sent:** %d
-- **Total Failed:** %d
-- **Last Sent:** %s
-%s%s
-## Usage
-
-Messages sent to Gotify will be automatically forwarded to WeChat.
 
-### Send via /send (Legacy Webhook)
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid id %q", c.Param("id")),
+			})
+			return
+		}
+		cfg := p.configSnapshot()
+		if cfg.ClientToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "client_token is not configured",
+			})
+			return
+		}
+
+		msg, err := fetchGotifyMessage(c.Request.Context(), newGotifyHTTPClient(cfg), cfg, id)
+		if errors.Is(err, errGotifyMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("message %d not found", id),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("failed to fetch message from Gotify: %v", err),
+			})
+			return
+		}
+
+		// 与消息流使用同一套过滤和路由规则，被过滤时返回原因
+		skipped := func(reason string) {
+			c.JSON(http.StatusOK, gin.H{
+				"success":   true,
+				"forwarded": false,
+				"reason":    reason,
+			})
+		}
+		if cfg.excludedApp(msg.AppID) {
+			skipped("excluded_app")
+			return
+		}
+		groups, ok := p.routeMessage(msg)
+		if !ok {
+			skipped("no_route")
+			return
+		}
+		out, reason := p.buildOutgoing(msg)
+		if reason != "" {
+			skipped(reason)
+			return
+		}
+		if len(groups) == 0 {
+			skipped("no_recipients")
+			return
+		}
+
+		var results sendResults
+		for _, g := range groups {
+			out.Account = g.Account
+			results = append(results, p.sendToMultiple(g.Recipients, out)...)
+		}
+		failed := len(results.errors())
+		p.logEvent(levelInfo, "message_replayed", logFields{"message_id": id, "recipients": len(results), "failed": failed},
+			"Replayed message %d to %d recipients, %d failed", id, len(results), failed)
+		if failed > 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success":   false,
+				"error":     fmt.Sprintf("failed to send to WeChat: %d/%d failed", failed, len(results)),
+				"forwarded": failed < len(results),
+				"msgids":    results.msgids(),
+				"results":   results,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"forwarded": true,
+			"msgids":    results.msgids(),
+			"results":   results,
+		})
+	})
+
+	// POST /token/refresh - 丢弃缓存的 access_token 并强制获取新 token
+	router.POST("/token/refresh", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+		if !p.checkWebhookSecret(c, false) {
+			return
+		}
+		cfg := p.configSnapshot()
+		if cfg.Backend == backendWorkBot {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "access token is not used by the work_bot backend",
+			})
+			return
+		}
+		acct, ok := cfg.account(c.Query("account"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("unknown account %q", c.Query("account")),
+			})
+			return
+		}
+
+		if _, err := p.getAccessToken(c.Request.Context(), acct, true); err != nil {
+			resp := gin.H{
+				"error": fmt.Sprintf("failed to refresh access token: %v", err),
+			}
+			var we *WeChatError
+			if errors.As(err, &we) {
+				resp["errcode"] = we.Code
+			}
+			c.JSON(http.StatusBadGateway, resp)
+			return
+		}
+
+		cache := p.tokenCacheFor(acct.AppID)
+		cache.mu.RLock()
+		expiresAt := cache.ExpiresAt
+		cache.mu.RUnlock()
+		p.logEvent(levelInfo, "token_refreshed", logFields{"account": acct.Name, "expires_at": expiresAt.Format(time.RFC3339)},
+			"Access token for account %s refreshed manually, expires at %s", acct.Name, expiresAt.Format(time.RFC3339))
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"account":    acct.Name,
+			"expires_at": expiresAt,
+		})
+	})
+
+	// GET /stats - 消息统计 JSON
+	router.GET("/stats", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+
+		cfg := p.configSnapshot()
+		sent, failed, lastSent, lastErr := p.msgMgr.Stats()
+		filtered, _ := p.msgMgr.Filtered()
+
+		var lastSentAt interface{}
+		if !lastSent.IsZero() {
+			lastSentAt = lastSent
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sent":           sent,
+			"failed":         failed,
+			"filtered":       filtered,
+			"escalations":    p.msgMgr.Escalations(),
+			"sentToday":      p.sentToday(cfg),
+			"lastSent":       lastSentAt,
+			"lastError":      lastErr.Message,
+			"lastErrorCount": lastErr.Count,
+			"recipients":     p.msgMgr.RecipientStats(),
+			"recentErrcodes": p.msgMgr.RecentErrcodes(),
+		})
+	})
+
+	// POST /stats/reset - 清零统计，返回清零前的值
+	router.POST("/stats/reset", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+
+		prev := p.msgMgr.Reset()
+		var lastSentAt interface{}
+		if !prev.LastSentAt.IsZero() {
+			lastSentAt = prev.LastSentAt
+		}
+		p.logEvent(levelInfo, "stats_reset", logFields{"sent": prev.TotalSent, "failed": prev.TotalFail, "filtered": prev.TotalFiltered},
+			"Statistics reset (sent %d, failed %d, filtered %d)", prev.TotalSent, prev.TotalFail, prev.TotalFiltered)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"previous": gin.H{
+				"sent":           prev.TotalSent,
+				"failed":         prev.TotalFail,
+				"filtered":       prev.TotalFiltered,
+				"escalations":    prev.Escalations,
+				"lastSent":       lastSentAt,
+				"lastError":      prev.LastError,
+				"lastErrorCount": prev.LastErrorCount,
+			},
+		})
+	})
+
+	// GET /history - 最近的投递记录
+	router.GET("/history", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"history": p.msgMgr.History(),
+		})
+	})
+
+	// GET /deadletter - 查看发送失败的消息，包含消息内容，配置了 webhook_secret 时需校验
+	router.GET("/deadletter", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+		if !p.checkWebhookSecret(c, false) {
+			return
+		}
+
+		letters, err := p.deadLetters()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"count":        len(letters),
+			"dead_letters": letters,
+		})
+	})
+
+	// POST /deadletter/retry - 重发死信，可通过 ?id= 指定（可重复），为空时重发全部
+	router.POST("/deadletter/retry", func(c *gin.Context) {
+		if !p.enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "plugin is disabled",
+			})
+			return
+		}
+		if !p.checkWebhookSecret(c, false) {
+			return
+		}
+
+		var ids []int64
+		for _, s := range c.QueryArray("id") {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("invalid id %q", s),
+				})
+				return
+			}
+			ids = append(ids, id)
+		}
+
+		res, err := p.retryDeadLetters(ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("failed to retry dead letters: %v", err),
+			})
+			return
+		}
+		p.logEvent(levelInfo, "dead_letters_retried", logFields{"retried": res.Retried, "succeeded": res.Succeeded, "failed": res.Failed},
+			"Retried %d dead letters: %d succeeded, %d failed", res.Retried, res.Succeeded, res.Failed)
+		c.JSON(http.StatusOK, res)
+	})
+
+	// GET /metrics - Prometheus 指标
+	router.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", metricsContentType)
+		c.Status(http.StatusOK)
+		p.writeMetrics(c.Writer)
+	})
+
+	// GET /debug - 脱敏的内部状态快照，需配置 webhook_secret
+	router.GET("/debug", func(c *gin.Context) {
+		if !p.checkWebhookSecret(c, true) {
+			return
+		}
+		c.JSON(http.StatusOK, p.debugSnapshot())
+	})
+
+	// GET /health - 供外部监控探测，未配置或消息流应连接但未连接时返回 503
+	router.GET("/health", func(c *gin.Context) {
+		p.mu.RLock()
+		configured := p.config != nil
+		streamExpected := p.enabled && p.stream != nil
+		streamConnected := p.stream != nil && p.stream.Connected()
+		tokenValid := false
+		if configured && p.config.Backend != backendWorkBot {
+			tokenValid = p.tokenValid(p.config.AppID)
+		}
+		resp := gin.H{
+			"enabled":         p.enabled,
+			"configured":      configured,
+			"streamConnected": streamConnected,
+			"tokenValid":      tokenValid,
+		}
+		p.mu.RUnlock()
+
+		status := http.StatusOK
+		if !configured || (streamExpected && !streamConnected) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, resp)
+	})
+}
+
+func (p *WeChatPlugin) GetDisplay(location *url.URL) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	cfg := p.configSnapshot()
+	if cfg == nil {
+		return translate(defaultLanguage, "display_not_configured")
+	}
+	t := cfg.text
+
+	base := p.basePath
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	webhookURL := &url.URL{Path: base}
+	if location != nil {
+		webhookURL.Scheme = location.Scheme
+		webhookURL.Host = location.Host
+	}
+
+	sendURL := webhookURL.ResolveReference(&url.URL{Path: "send"})
+	testURL := webhookURL.ResolveReference(&url.URL{Path: "test"})
+
+	// 已关闭的端点不在使用说明中展示
+	sendUsage, testUsage := "", ""
+	if cfg.EnableSendEndpoint {
+		sendUsage = fmt.Sprintf(`
+%s
 `+"`"+`POST %s`+"`"+`
 
 `+"```json"+`
 {
-  "title": "Message Title",
-  "content": "Message Content"
+  "title": "%s",
+  "content": "%s"
 }
 `+"```"+`
+`, t("display_send_usage"), sendURL.String(), t("display_example_title"), t("display_example_body"))
+	}
+	if cfg.EnableTestEndpoint {
+		testUsage = fmt.Sprintf("\n%s\n", t("display_test_usage", testURL.String()))
+	}
 
-### Test Connection
-Click here to test: [Send Test Message](%s)
-`, status, maskString(p.config.AppID), maskString(p.config.TemplateID),
-		recipientInfo,
-		sent, failed, lastSentStr, lastErrInfo,
+	status := t("status_disabled")
+	if p.enabled {
+		status = t("status_enabled")
+		if p.paused.Load() {
+			status = t("status_paused", cfg.ForwardLimit)
+		}
+	}
+
+	// 构建每日配额，配置了多个账号时逐个列出（配额按账号分别计算）
+	sentToday := p.sentToday(cfg)
+	var total int64
+	for _, q := range sentToday {
+		total += q.Count
+	}
+	todayInfo := t("stats_today", total)
+	if cfg.DailyQuotaWarn > 0 {
+		todayInfo += t("stats_quota_warn", cfg.DailyQuotaWarn)
+	}
+	if cfg.DailyQuotaHard > 0 {
+		todayInfo += t("stats_quota_hard", cfg.DailyQuotaHard)
+	}
+	todayInfo += "\n"
+	if len(cfg.Accounts) > 0 {
+		for _, a := range cfg.allAccounts() {
+			todayInfo += t("stats_today_account", a.Name, sentToday[a.Name].AppID, sentToday[a.Name].Count)
+		}
+	}
+
+	// 构建金丝雀检测状态
+	canaryInfo := ""
+	if cfg.CanaryInterval > 0 {
+		canaryStatus := t("canary_pending")
+		if res, ok := p.canaryStatus(); ok {
+			if res.Err != "" {
+				canaryStatus = t("canary_degraded", res.At.Format("2006-01-02 15:04:05"), res.Err)
+			} else {
+				canaryStatus = t("canary_ok", res.At.Format("2006-01-02 15:04:05"))
+			}
+		}
+		canaryInfo = t("canary_line", canaryStatus)
+	}
+
+	// 构建接收者列表
+	byRecipient := p.msgMgr.RecipientStats()
+	recipientInfo := ""
+	if len(cfg.Recipients) > 0 {
+		recipientInfo = t("recipients_heading")
+		for _, r := range cfg.Recipients {
+			rs := byRecipient[r.Name]
+			floorInfo := t("recipient_stats", rs.Sent, rs.Failed)
+			if r.MinPriority != nil {
+				floorInfo += t("recipient_floor", *r.MinPriority, rs.Filtered)
+			}
+			floorInfo += t("recipient_stats_end")
+			address := maskString(r.OpenID)
+			if cfg.Backend == backendWorkBot {
+				address = maskString(r.WebhookURL)
+			}
+			recipientInfo += t("recipient_line", r.Name, address, floorInfo)
+		}
+	} else if cfg.OpenID != "" {
+		rs := byRecipient[legacyRecipientName]
+		recipientInfo = t("recipient_legacy", maskString(cfg.OpenID), rs.Sent, rs.Failed)
+	}
+	if len(cfg.FallbackRecipients) > 0 {
+		fallbacks := make([]string, 0, len(cfg.FallbackRecipients))
+		for _, openid := range cfg.FallbackRecipients {
+			fallbacks = append(fallbacks, maskString(openid))
+		}
+		recipientInfo += t("recipient_fallback", strings.Join(fallbacks, ", "), p.msgMgr.Escalations())
+	}
+
+	// 获取消息统计
+	sent, failed, lastSent, lastErr := p.msgMgr.Stats()
+	filtered, _ := p.msgMgr.Filtered()
+	lastSentStr := t("stats_never")
+	if !lastSent.IsZero() {
+		lastSentStr = lastSent.Format("2006-01-02 15:04:05")
+	}
+	lastErrInfo := ""
+	if lastErr.Message != "" {
+		repeatInfo := ""
+		if lastErr.Count > 1 {
+			repeatInfo = t("stats_error_repeat", lastErr.Count, lastErr.FirstSeen.Format("2006-01-02 15:04:05"))
+		}
+		lastErrInfo = t("stats_last_error", lastErr.Message, repeatInfo)
+	}
+	if counts := p.msgMgr.RecentErrcodes(); len(counts) > 0 {
+		lastErrInfo += t("stats_errcodes", formatErrcodes(counts))
+	}
+
+	configInfo := t("config_appid", maskString(cfg.AppID), maskString(cfg.TemplateID))
+	for _, a := range cfg.Accounts {
+		configInfo += t("config_account", a.Name, maskString(a.AppID), maskString(a.TemplateID))
+	}
+	if cfg.Backend == backendWorkBot {
+		configInfo = t("config_workbot")
+	}
+
+	// 构建 Stream 状态
+	streamInfo := ""
+	if problem := cfg.streamConfigProblem(cfg.Language); problem != "" {
+		streamInfo = t("stream_heading", t("stream_not_started")) + t("stream_warning", problem)
+	} else if len(cfg.MessageRoutes) > 0 || len(cfg.Routes) > 0 {
+		streamStatus := t("stream_disconnected")
+		if p.stream != nil && p.stream.Connected() {
+			streamStatus = t("stream_connected")
+		} else if p.stream != nil && p.stream.AuthFailed() {
+			streamStatus = t("stream_auth_failed")
+		}
+		streamInfo = t("stream_heading", streamStatus)
+		if p.stream != nil {
+			forwarded, filtered := p.stream.Forwarded()
+			lastMessage := t("stats_never")
+			if at := p.stream.LastMessageAt(); !at.IsZero() {
+				lastMessage = at.Format("2006-01-02 15:04:05")
+			}
+			streamInfo += t("stream_forwarded", forwarded, filtered, lastMessage)
+		}
+		streamInfo += t("stream_routes")
+		for _, route := range cfg.Routes {
+			streamInfo += fmt.Sprintf("  - %s\n", cfg.describeRoute(route))
+		}
+		for _, route := range cfg.MessageRoutes {
+			streamInfo += fmt.Sprintf("  - `%s`\n", route.Path)
+		}
+	}
+
+	return fmt.Sprintf(`# %s
+
+**%s:** %s
+
+## %s
+%s%s
+## %s
+%s%s%s%s%s
+## %s
+
+%s
+%s%s`, t("display_title"), t("display_status"), status,
+		t("display_config"), configInfo, recipientInfo,
+		t("display_stats"), t("stats_totals", sent, failed, filtered, lastSentStr), todayInfo, lastErrInfo, canaryInfo,
 		streamInfo,
-		sendURL.String(), testURL.String())
+		t("display_usage"), t("display_usage_forward"),
+		sendUsage, testUsage)
+}
+
+// allowForward 检查消息流转发限额，超过 ForwardLimit 时自动暂停并通知一次
+func (p *WeChatPlugin) allowForward() bool {
+	if p.paused.Load() {
+		return false
+	}
+	limit := p.configSnapshot().ForwardLimit
+	if limit <= 0 {
+		return true
+	}
+	if p.forwarded.Add(1) <= limit {
+		return true
+	}
+	if p.paused.CompareAndSwap(false, true) {
+		p.logEvent(levelWarn, "forwarding_paused", logFields{"limit": limit}, "Forward limit %d reached, pausing until /resume", limit)
+		p.msgMgr.NotifyPaused(limit)
+	}
+	return false
+}
+
+// describeRoute 生成路由的可读描述，用于状态展示
+func (c *Config) describeRoute(route Route) string {
+	name := route.Name
+	if name == "" {
+		name = c.text("route_unnamed")
+	}
+	cond := c.text("route_all_apps")
+	if route.Match.AppID != nil {
+		cond = c.appLabel(*route.Match.AppID)
+	}
+	if route.Match.MinPriority != nil {
+		cond += c.text("route_priority", *route.Match.MinPriority)
+	}
+	if route.Match.TitlePattern != "" {
+		cond += c.text("route_title", route.Match.TitlePattern)
+	}
+	if len(route.Match.MessageContains) > 0 {
+		cond += c.text("route_contains", strings.Join(route.Match.MessageContains, "/"))
+	}
+	if len(route.Match.MessageNotContains) > 0 {
+		cond += c.text("route_not_contains", strings.Join(route.Match.MessageNotContains, "/"))
+	}
+	target := c.text("route_all_recipients")
+	if len(route.Recipients) > 0 {
+		target = strings.Join(route.Recipients, ", ")
+	}
+	if route.Account != "" {
+		target += c.text("route_account", route.Account)
+	}
+	if route.JumpURL != "" {
+		target += c.text("route_jump", route.JumpURL)
+	}
+	return fmt.Sprintf("**%s:** %s → %s", name, cond, target)
+}
+
+// recipientGroup 通过同一公众号账号发送的接收者
+type recipientGroup struct {
+	Account    string
+	Recipients []Recipient
+}
+
+// routeMessage 按路由规则解析消息的接收者分组，消息流与 /send 共用；消息被路由规则丢弃时返回 false
+func (p *WeChatPlugin) routeMessage(msg GotifyMessage) ([]recipientGroup, bool) {
+	res, ok := p.configSnapshot().router.Resolve(msg)
+	if !ok {
+		return nil, false
+	}
+	return p.recipientGroups(res), true
+}
+
+// recipientGroups 根据路由结果按账号分组解析接收者，组内保持配置中的顺序，空组被省略
+// 路由设置了 jump_url 时覆盖接收者的跳转链接（路由 > 接收者 > 全局），多条路由命中同一接收者时按配置顺序取第一个
+func (p *WeChatPlugin) recipientGroups(res RouteResult) []recipientGroup {
+	if len(res.Routes) == 0 {
+		if res.All {
+			return []recipientGroup{{Recipients: p.getAllRecipients()}}
+		}
+		return nil
+	}
+
+	var order []string
+	wanted := make(map[string]map[string]string) // 账号 -> 接收者名称 -> 路由跳转链接
+	all := make(map[string]bool)
+	allJump := make(map[string]string) // 账号 -> 面向全部接收者的路由跳转链接
+	for _, route := range res.Routes {
+		if _, ok := wanted[route.Account]; !ok {
+			order = append(order, route.Account)
+			wanted[route.Account] = make(map[string]string)
+		}
+		if len(route.Recipients) == 0 {
+			all[route.Account] = true
+			if allJump[route.Account] == "" {
+				allJump[route.Account] = route.JumpURL
+			}
+		}
+		for _, name := range route.Recipients {
+			if wanted[route.Account][name] == "" {
+				wanted[route.Account][name] = route.JumpURL
+			}
+		}
+	}
+
+	var groups []recipientGroup
+	for _, account := range order {
+		g := recipientGroup{Account: account}
+		for _, r := range p.getAllRecipients() {
+			jump, ok := wanted[account][r.Name]
+			if !ok && !all[account] {
+				continue
+			}
+			if jump == "" {
+				jump = allJump[account]
+			}
+			if jump != "" {
+				r.JumpURL = jump
+			}
+			g.Recipients = append(g.Recipients, r)
+		}
+		if len(g.Recipients) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
 }
 
-// getAllOpenIDs 获取所有配置的 OpenID
-func (p *WeChatPlugin) getAllOpenIDs() []string {
-	if len(p.config.Recipients) > 0 {
-		openIDs := make([]string, 0, len(p.config.Recipients))
-		for _, r := range p.config.Recipients {
-			openIDs = append(openIDs, r.OpenID)
+// recipientsByName 按名称查找接收者，返回找到的接收者（按配置顺序）和未知的名称
+func (p *WeChatPlugin) recipientsByName(names []string) ([]Recipient, []string) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var recipients []Recipient
+	for _, r := range p.getAllRecipients() {
+		if wanted[r.Name] {
+			recipients = append(recipients, r)
+			delete(wanted, r.Name)
+		}
+	}
+	var unknown []string
+	for _, name := range names {
+		if wanted[name] {
+			unknown = append(unknown, name)
+			delete(wanted, name)
 		}
-		return openIDs
+	}
+	return recipients, unknown
+}
+
+// legacyRecipientName 单 OpenID 模式下接收者的名称
+const legacyRecipientName = "default"
+
+// getAllRecipients 获取所有配置的接收者
+func (p *WeChatPlugin) getAllRecipients() []Recipient {
+	cfg := p.configSnapshot()
+	if len(cfg.Recipients) > 0 {
+		return cfg.Recipients
 	}
 	// 向后兼容：单 OpenID 模式
-	if p.config.OpenID != "" {
-		return []string{p.config.OpenID}
+	if cfg.OpenID != "" {
+		return []Recipient{{Name: legacyRecipientName, OpenID: cfg.OpenID}}
 	}
 	return nil
 }
 
-// sendToMultiple 向多个 OpenID 发送消息，返回所有错误
-func (p *WeChatPlugin) sendToMultiple(openIDs []string, title, content string) []error {
+// sendDrainTimeout Disable 等待进行中的发送完成的最长时间
+const sendDrainTimeout = 15 * time.Second
+
+// errShuttingDown 插件正在停用，拒绝新的发送
+var errShuttingDown = errors.New("plugin is shutting down")
+
+// runContext 返回发送使用的 context，Disable 时被取消；未启用过时返回 context.Background()
+func (p *WeChatPlugin) runContext() context.Context {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	if p.runCtx == nil {
+		return context.Background()
+	}
+	return p.runCtx
+}
+
+// beginSend 登记一次发送并返回其 context，插件正在停用时返回 false；成功时调用方需在完成后调用 p.sends.Done()
+func (p *WeChatPlugin) beginSend() (context.Context, bool) {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	if p.closing {
+		return nil, false
+	}
+	p.sends.Add(1)
+	if p.runCtx == nil {
+		return context.Background(), true
+	}
+	return p.runCtx, true
+}
+
+// drainSends 拒绝新的发送，并最多等待 timeout 让进行中的发送完成，超时后取消仍挂起的请求
+func (p *WeChatPlugin) drainSends(timeout time.Duration) {
+	p.sendMu.Lock()
+	p.closing = true
+	cancel := p.cancelRun
+	p.sendMu.Unlock()
+	if cancel != nil {
+		defer cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.sends.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		p.logEvent(levelWarn, "shutdown_timeout", logFields{"in_flight": p.inFlight.Load()},
+			"Timed out after %v waiting for %d in-flight sends", timeout, p.inFlight.Load())
+	}
+}
+
+// sendResult 发送给单个接收者的结果
+type sendResult struct {
+	Recipient string `json:"recipient"`
+	Target    string `json:"target"` // 脱敏的 OpenID 或群机器人名称
+	OK        bool   `json:"ok"`
+	Msgid     int64  `json:"msgid,omitempty"`    // 模板消息 msgid，群机器人没有 msgid
+	Errcode   int    `json:"errcode,omitempty"`  // 微信错误码，非微信接口错误时为 0
+	Errmsg    string `json:"errmsg,omitempty"`   // 失败原因
+	Fallback  bool   `json:"fallback,omitempty"` // 是否为改发的备用接收者
+	Filtered  bool   `json:"filtered,omitempty"` // 消息优先级低于接收者的 min_priority，未发送
+
+	openid string
+	err    error
+}
+
+// newSendResult 根据发送结果创建 sendResult
+func newSendResult(r Recipient, target string, msgid int64, err error) sendResult {
+	res := sendResult{Recipient: r.Name, Target: target, OK: err == nil, Msgid: msgid, openid: r.OpenID, err: err}
+	if err != nil {
+		res.Errmsg = err.Error()
+		var we *WeChatError
+		if errors.As(err, &we) {
+			res.Errcode = we.Code
+		}
+	}
+	return res
+}
+
+// sendResults 一次或多次扇出发送的结果，按接收者排列
+type sendResults []sendResult
+
+// errors 返回失败接收者的错误，带脱敏的接收者标识；被 min_priority 过滤的接收者不算失败
+func (rs sendResults) errors() []error {
+	var errs []error
+	for _, r := range rs {
+		if !r.OK && !r.Filtered {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Target, r.err))
+		}
+	}
+	return errs
+}
+
+// msgids 返回发送成功的模板消息 msgid，按脱敏 OpenID
+func (rs sendResults) msgids() map[string]int64 {
+	msgids := make(map[string]int64)
+	for _, r := range rs {
+		if r.OK && r.Msgid != 0 {
+			msgids[maskString(r.openid)] = r.Msgid
+		}
+	}
+	return msgids
+}
+
+// delivered 返回发送成功的接收者数
+func (rs sendResults) delivered() int {
+	n := 0
+	for _, r := range rs {
+		if r.OK {
+			n++
+		}
+	}
+	return n
+}
+
+// sendToMultiple 向多个接收者发送消息，按接收者返回发送结果，被过滤的接收者带 Filtered 标记
+// 消息优先级低于接收者 MinPriority 的（BypassFloor 时除外），跳过该接收者并记为已过滤；所有接收者都失败时改发给 fallback_recipients
+func (p *WeChatPlugin) sendToMultiple(recipients []Recipient, msg OutgoingMessage) sendResults {
+	cfg := p.configSnapshot()
 	var (
-		errs []error
+		targets  []Recipient
+		filtered sendResults
+	)
+	for _, r := range recipients {
+		if !msg.BypassFloor && r.MinPriority != nil && msg.Priority < *r.MinPriority {
+			p.msgMgr.RecordFiltered(r.Name)
+			filtered = append(filtered, sendResult{Recipient: r.Name, Target: cfg.describeTarget(r), Filtered: true, openid: r.OpenID})
+			continue
+		}
+		targets = append(targets, r)
+	}
+
+	ctx, ok := p.beginSend()
+	if !ok {
+		p.logEvent(levelWarn, "send_rejected", nil, "Plugin is shutting down, dropping message %q", msg.Title)
+		results := make(sendResults, 0, len(targets)+len(filtered))
+		for _, r := range targets {
+			results = append(results, newSendResult(r, cfg.describeTarget(r), 0, errShuttingDown))
+		}
+		return append(results, filtered...)
+	}
+	defer p.sends.Done()
+
+	var (
+		dead []DeadLetter
 		mu   sync.Mutex
 		wg   sync.WaitGroup
 	)
 
-	for _, oid := range openIDs {
-		wg.Add(1)
-		go func(openID string) {
-			defer wg.Done()
-			if err := p.sendToWeChat(openID, title, content); err != nil {
-				mu.Lock()
-				errs = append(errs, fmt.Errorf("openid %s: %w", maskString(openID), err))
-				mu.Unlock()
-			}
-		}(oid)
+	// 同一批接收者共享同一份重试预算；备用接收者失败时不记录死信，原消息已记录在主接收者的死信中
+	sendAll := func(recipients []Recipient, fallback bool) sendResults {
+		results := make(sendResults, len(recipients))
+		budget := newRetryBudget(cfg.fanoutRetryBudget(len(recipients)))
+		for i, r := range recipients {
+			wg.Add(1)
+			go func(i int, r Recipient) {
+				defer wg.Done()
+				p.inFlight.Add(1)
+				defer p.inFlight.Add(-1)
+				msgid, err := p.sendToWeChat(ctx, r, msg, budget)
+				p.msgMgr.RecordRecipient(r.Name, err == nil)
+				results[i] = newSendResult(r, cfg.describeTarget(r), msgid, err)
+				results[i].Fallback = fallback
+				if err != nil && !fallback {
+					mu.Lock()
+					dead = append(dead, p.newDeadLetter(r, msg, err))
+					mu.Unlock()
+				}
+			}(i, r)
+		}
+		wg.Wait()
+		return results
 	}
 
-	wg.Wait()
+	results := sendAll(targets, false)
+	failed := len(results.errors())
+
+	// 只有全部失败才改发，部分成功说明链路正常，不打扰值班人员
+	if len(targets) > 0 && failed == len(targets) && len(cfg.FallbackRecipients) > 0 {
+		fallbacks := cfg.fallbackRecipients()
+		p.logEvent(levelWarn, "message_escalated", logFields{"title": msg.Title, "failed": failed, "fallbacks": len(fallbacks)},
+			"All %d recipients failed for %q, escalating to %d fallback recipients", failed, msg.Title, len(fallbacks))
+		p.msgMgr.RecordEscalation()
+		results = append(results, sendAll(fallbacks, true)...)
+	}
 
-	successCount := len(openIDs) - len(errs)
+	errs := results.errors()
+	total := len(results)
+	successCount := total - len(errs)
+	// 被过滤的接收者不计入本次发送，但在结果中列出，避免全部被过滤时调用方误以为已送达
+	results = append(results, filtered...)
 
 	if len(errs) > 0 {
+		p.addDeadLetters(dead)
 		p.msgMgr.RecordFailure(len(errs))
-		p.msgMgr.NotifyError(title, errs, len(openIDs))
+		p.msgMgr.NotifyError(msg.Title, errs, total)
 	}
 
 	if successCount > 0 {
 		p.msgMgr.RecordSuccess(successCount)
-		p.msgMgr.NotifyDelivery(title, successCount, len(openIDs))
+		if !cfg.DisableSelfNotify {
+			p.msgMgr.NotifyDelivery(msg.Title, successCount, total)
+		}
 	}
 
-	return errs
+	return results
 }
 
-// sendToWeChat 向指定 OpenID 发送微信模板消息
-func (p *WeChatPlugin) sendToWeChat(openID, title, content string) error {
-	if p.config == nil {
-		return fmt.Errorf("plugin not configured")
+// retryBudget 一条消息在所有接收者之间共享的重试次数，避免共同故障时重试成倍放大
+type retryBudget struct {
+	remaining atomic.Int64
+}
+
+// newRetryBudget 创建共享重试预算
+func newRetryBudget(n int) *retryBudget {
+	b := &retryBudget{}
+	b.remaining.Store(int64(n))
+	return b
+}
+
+// take 消耗一次重试机会，预算耗尽时返回 false
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return false
+	}
+	for {
+		n := b.remaining.Load()
+		if n <= 0 {
+			return false
+		}
+		if b.remaining.CompareAndSwap(n, n-1) {
+			return true
+		}
 	}
+}
 
-	token, err := p.getAccessToken()
+// retryableError 标记可重试的错误（如网络错误）
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// tokenRejectedError 微信拒绝了发送时使用的 access_token
+type tokenRejectedError struct {
+	err   error
+	token string
+}
+
+func (e *tokenRejectedError) Error() string { return e.err.Error() }
+func (e *tokenRejectedError) Unwrap() error { return e.err }
+
+// isRetryable 判断错误是否可重试：网络等临时错误，或被归为可重试的微信错误码
+func isRetryable(err error) bool {
+	var re *retryableError
+	if errors.As(err, &re) {
+		return true
+	}
+	var we *WeChatError
+	return errors.As(err, &we) && we.IsRetryable()
+}
+
+// sendToWeChat 向接收者发送消息（模板消息或群机器人），可重试的错误在 budget 允许时重试
+// 返回模板消息的 msgid，群机器人没有 msgid，返回 0
+func (p *WeChatPlugin) sendToWeChat(ctx context.Context, r Recipient, msg OutgoingMessage, budget *retryBudget) (int64, error) {
+	target := p.configSnapshot().describeTarget(r)
+	attempts, msgid, err := p.sendWithRetry(ctx, r, target, msg, budget)
+
+	rec := DeliveryRecord{
+		Time:      time.Now(),
+		Title:     msg.Title,
+		Recipient: r.Name,
+		Target:    target,
+		Success:   err == nil,
+		Attempts:  attempts,
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
+		rec.Error = err.Error()
+		p.msgMgr.RecordErrcode(err)
 	}
+	p.msgMgr.RecordDelivery(rec)
+	return msgid, err
+}
 
-	apiURL := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/message/template/send?access_token=%s", token)
+// sendWithRetry 执行发送及重试，返回实际调用接口的次数和 msgid；ctx 取消时中断请求并停止重试
+func (p *WeChatPlugin) sendWithRetry(ctx context.Context, r Recipient, target string, msg OutgoingMessage, budget *retryBudget) (int, int64, error) {
+	cfg := p.configSnapshot()
+	acct, ok := cfg.account(msg.Account)
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown account %q", msg.Account)
+	}
+	if err := p.quota.check(acct.AppID, cfg.DailyQuotaHard, cfg.location); err != nil {
+		return 0, 0, err
+	}
 
-	requestData := TemplateMessageRequest{
-		ToUser:     openID,
-		TemplateID: p.config.TemplateID,
-		URL:        p.config.JumpURL,
-		Data: map[string]interface{}{
-			"title": map[string]string{
-				"value": title,
-			},
-			"content": map[string]string{
-				"value": content,
-			},
-		},
+	backoff := cfg.RetryBackoff
+	attempts, retries, refreshed := 0, 0, false
+	for {
+		attempts++
+		// 每次调用（含重试）都经过限流，重试等待期间不占用并发名额
+		// 停用时 ctx 被取消，排队中的发送直接放弃，不会在停用后才发出
+		release, err := p.limiter.Load().acquire(ctx)
+		if err != nil {
+			return attempts, 0, err
+		}
+		var msgid int64
+		if cfg.Backend == backendWorkBot {
+			err = p.sendWorkBotMessage(ctx, r, msg)
+		} else {
+			msgid, err = p.sendTemplateMessage(ctx, acct, r, msg)
+		}
+		release()
+		if err == nil {
+			p.recordDailySend(acct.AppID)
+			return attempts, msgid, nil
+		}
+
+		// token 被微信拒绝时丢弃缓存，用新 token 重发一次，不计入重试次数
+		var tre *tokenRejectedError
+		if !refreshed && errors.As(err, &tre) {
+			refreshed = true
+			p.logEvent(levelWarn, "token_rejected", sendErrorFields(target, err), "Access token rejected, refreshing and resending to %s: %v", target, err)
+			if err := p.refreshRejectedToken(ctx, acct, tre.token); err != nil {
+				return attempts, 0, fmt.Errorf("failed to refresh access token: %w", err)
+			}
+			continue
+		}
+
+		// 不可重试的错误或已取消时立即失败，不消耗重试次数
+		if ctx.Err() != nil || !isRetryable(err) || retries >= cfg.MaxRetries || !budget.take() {
+			return attempts, 0, err
+		}
+		retries++
+		fields := sendErrorFields(target, err)
+		fields["retry"] = retries
+		p.logEvent(levelWarn, "send_retry", fields, "Send to %s failed, retrying in %v (%d/%d): %v",
+			target, backoff, retries, cfg.MaxRetries, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempts, 0, err
+		}
+		backoff *= 2
 	}
+}
 
-	jsonData, err := json.Marshal(requestData)
+// recordDailySend 累计 appID 当日发送数，首次达到 DailyQuotaWarn 时发送预警
+func (p *WeChatPlugin) recordDailySend(appID string) {
+	cfg := p.configSnapshot()
+	count, crossed := p.quota.record(appID, cfg.DailyQuotaWarn, cfg.location)
+	if crossed {
+		p.logEvent(levelWarn, "quota_warning", logFields{"appid": maskString(appID), "count": count},
+			"Daily quota warning: %d messages sent today from %s", count, maskString(appID))
+		p.msgMgr.NotifyQuotaWarning(maskString(appID), count, cfg.DailyQuotaWarn, cfg.DailyQuotaHard)
+	}
+}
+
+// sendTemplateMessage 通过公众号账号 acct 向接收者发送一次模板消息或订阅通知（按 message_api），返回 msgid
+func (p *WeChatPlugin) sendTemplateMessage(ctx context.Context, acct Account, r Recipient, msg OutgoingMessage) (int64, error) {
+	cfg := p.configSnapshot()
+	if cfg == nil {
+		return 0, fmt.Errorf("plugin not configured")
+	}
+
+	token, err := p.getAccessToken(ctx, acct, false)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return 0, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-		Timeout: 10 * time.Second,
+	msg = cfg.prepareText(msg)
+
+	var (
+		apiURL      string
+		requestData interface{}
+	)
+	data := cfg.buildTemplateData(msg)
+	if cfg.MessageAPI == messageAPISubscribe {
+		apiURL = fmt.Sprintf("%s/cgi-bin/message/subscribe/bizsend?access_token=%s", wechatAPIBase, token)
+		fields := make(map[string]SubscribeField, len(data))
+		for name, f := range data {
+			fields[name] = SubscribeField{Value: f.Value}
+		}
+		requestData = SubscribeMessageRequest{
+			ToUser:      r.OpenID,
+			TemplateID:  cfg.templateFor(r, acct),
+			Page:        cfg.jumpURLFor(r),
+			MiniProgram: cfg.miniProgram(),
+			Data:        fields,
+		}
+	} else {
+		apiURL = fmt.Sprintf("%s/cgi-bin/message/template/send?access_token=%s", wechatAPIBase, token)
+		requestData = TemplateMessageRequest{
+			ToUser:      r.OpenID,
+			TemplateID:  cfg.templateFor(r, acct),
+			URL:         cfg.jumpURLFor(r),
+			TopColor:    cfg.TopColor,
+			MiniProgram: cfg.miniProgram(),
+			Data:        data,
+		}
 	}
 
-	resp, err := client.Post(apiURL, "application/json", strings.NewReader(string(jsonData)))
+	jsonData, err := json.Marshal(requestData)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := p.postJSON(ctx, apiURL, jsonData)
+	if err != nil {
+		// 请求地址中带有 access_token，不能原样出现在错误中
+		return 0, &retryableError{fmt.Errorf("failed to send request: %w", redactURLError(err))}
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return 0, &retryableError{fmt.Errorf("failed to read response: %w", err)}
 	}
 
 	var apiResp WechatAPIResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+		err = fmt.Errorf("failed to parse response (HTTP %d): %w", resp.StatusCode, err)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return 0, &retryableError{err}
+		}
+		return 0, err
 	}
 
 	if apiResp.Errcode != 0 {
-		return fmt.Errorf("WeChat API error: code=%d, msg=%s", apiResp.Errcode, apiResp.Errmsg)
+		err := newWeChatError(apiResp.Errcode, apiResp.Errmsg)
+		if err.TokenRejected() {
+			return 0, &tokenRejectedError{err: err, token: token}
+		}
+		return 0, err
 	}
 
-	log.Printf("[WeChat Plugin] Message sent successfully to %s, msgid: %d", maskString(openID), apiResp.Msgid)
-	return nil
+	p.logEvent(levelInfo, "message_sent", logFields{"recipient": maskString(r.OpenID), "msgid": apiResp.Msgid},
+		"Message sent successfully to %s, msgid: %d", maskString(r.OpenID), apiResp.Msgid)
+	return apiResp.Msgid, nil
+}
+
+// newWeChatHTTPClient 创建调用微信接口的 HTTP 客户端，proxy 为 nil 时按环境变量决定是否使用代理
+// 默认校验 TLS 证书，skipTLSVerify 仅用于调试
+func newWeChatHTTPClient(timeout time.Duration, proxy *url.URL, skipTLSVerify bool) *http.Client {
+	proxyFunc := http.ProxyFromEnvironment
+	if proxy != nil {
+		proxyFunc = http.ProxyURL(proxy)
+	}
+	transport := &http.Transport{
+		Proxy:               proxyFunc,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if skipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// tokenCacheFor 返回 appID 对应的 token 缓存，不存在时创建
+func (p *WeChatPlugin) tokenCacheFor(appID string) *TokenCache {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	if p.tokenCaches == nil {
+		p.tokenCaches = make(map[string]*TokenCache)
+	}
+	cache, ok := p.tokenCaches[appID]
+	if !ok {
+		cache = &TokenCache{}
+		p.tokenCaches[appID] = cache
+	}
+	return cache
 }
 
-func (p *WeChatPlugin) getAccessToken() (string, error) {
-	p.tokenCache.mu.RLock()
-	if p.tokenCache.Token != "" && time.Now().Before(p.tokenCache.ExpiresAt.Add(-5*time.Minute)) {
-		token := p.tokenCache.Token
-		p.tokenCache.mu.RUnlock()
-		return token, nil
+// newWeChatRequest 创建调用微信接口的请求，设置 User-Agent，ctx 取消时中断请求
+func (p *WeChatPlugin) newWeChatRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
 	}
-	p.tokenCache.mu.RUnlock()
+	req.Header.Set("User-Agent", p.configSnapshot().userAgent())
+	return req, nil
+}
 
-	p.tokenCache.mu.Lock()
-	defer p.tokenCache.mu.Unlock()
+// postJSON 以 ctx 发送 JSON POST 请求，token 和消息发送请求共用
+func (p *WeChatPlugin) postJSON(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	req, err := p.newWeChatRequest(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return p.httpClient.Load().Do(req)
+}
 
-	if p.tokenCache.Token != "" && time.Now().Before(p.tokenCache.ExpiresAt.Add(-5*time.Minute)) {
-		return p.tokenCache.Token, nil
+// wechatAPIBase 微信公众平台接口地址
+var wechatAPIBase = "https://api.weixin.qq.com"
+
+// wechatTokenLifetime 微信 access_token 的常规有效期（expires_in 7200 秒）
+const wechatTokenLifetime = 2 * time.Hour
+
+// getAccessToken 返回账号 acct 可用的 access_token，forceRefresh 时跳过缓存并要求微信签发新 token
+func (p *WeChatPlugin) getAccessToken(ctx context.Context, acct Account, forceRefresh bool) (string, error) {
+	cfg := p.configSnapshot()
+	cache := p.tokenCacheFor(acct.AppID)
+	if !forceRefresh {
+		cache.mu.RLock()
+		if cache.Token != "" && time.Now().Before(cache.ExpiresAt.Add(-cfg.TokenRefreshMargin)) {
+			token := cache.Token
+			cache.mu.RUnlock()
+			return token, nil
+		}
+		cache.mu.RUnlock()
 	}
 
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if !forceRefresh {
+		if cache.Token != "" && time.Now().Before(cache.ExpiresAt.Add(-cfg.TokenRefreshMargin)) {
+			return cache.Token, nil
+		}
+
+		// 优先使用持久化的 token，避免重启后浪费仍有效的 token
+		if stored, ok := p.loadToken(acct.AppID); ok && time.Now().Before(stored.ExpiresAt.Add(-cfg.TokenRefreshMargin)) {
+			cache.Token = stored.Token
+			cache.ExpiresAt = stored.ExpiresAt
+			return stored.Token, nil
+		}
+	}
+
+	return p.fetchTokenLocked(ctx, acct, cache, forceRefresh)
+}
+
+// fetchTokenLocked 调用 stable_token 接口获取 token 并写入 cache，调用方需持有 cache.mu
+// stable_token 在普通模式下会返回仍在有效期内的同一个 token，forceRefresh 时才会签发新 token
+func (p *WeChatPlugin) fetchTokenLocked(ctx context.Context, acct Account, cache *TokenCache, forceRefresh bool) (string, error) {
 	requestParams := map[string]interface{}{
 		"grant_type": "client_credential",
-		"appid":      p.config.AppID,
-		"secret":     p.config.AppSecret,
+		"appid":      acct.AppID,
+		"secret":     acct.AppSecret,
+	}
+	if forceRefresh {
+		requestParams["force_refresh"] = true
 	}
 
 	jsonData, err := json.Marshal(requestParams)
@@ -502,16 +2155,9 @@ func (p *WeChatPlugin) getAccessToken() (string, error) {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-		Timeout: 10 * time.Second,
-	}
-
-	resp, err := client.Post("https://api.weixin.qq.com/cgi-bin/stable_token", "application/json", strings.NewReader(string(jsonData)))
+	resp, err := p.postJSON(ctx, wechatAPIBase+"/cgi-bin/stable_token", jsonData)
 	if err != nil {
-		return "", fmt.Errorf("failed to request token: %w", err)
+		return "", fmt.Errorf("failed to request token: %w", redactURLError(err))
 	}
 	defer resp.Body.Close()
 
@@ -526,22 +2172,48 @@ func (p *WeChatPlugin) getAccessToken() (string, error) {
 	}
 
 	if tokenResp.Errcode != 0 {
-		return "", fmt.Errorf("WeChat API error: code=%d, msg=%s", tokenResp.Errcode, tokenResp.Errmsg)
+		return "", newWeChatError(tokenResp.Errcode, tokenResp.Errmsg)
 	}
 
 	if tokenResp.AccessToken == "" {
 		return "", fmt.Errorf("empty access token received")
 	}
 
-	p.tokenCache.Token = tokenResp.AccessToken
-	p.tokenCache.ExpiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	cache.Token = tokenResp.AccessToken
+	cache.ExpiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	p.saveToken(acct.AppID, cache.Token, cache.ExpiresAt)
 
 	return tokenResp.AccessToken, nil
 }
 
+// refreshRejectedToken 丢弃被拒绝的 access_token（内存缓存与持久化存储）并强制获取新 token
+// 仅当缓存仍是 rejected 时才刷新，避免并发发送时反复强制刷新（微信限制强制刷新的频率）
+func (p *WeChatPlugin) refreshRejectedToken(ctx context.Context, acct Account, rejected string) error {
+	cache := p.tokenCacheFor(acct.AppID)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.Token != "" && cache.Token != rejected {
+		return nil
+	}
+	cache.Token = ""
+	cache.ExpiresAt = time.Time{}
+	p.deleteToken(acct.AppID, rejected)
+
+	_, err := p.fetchTokenLocked(ctx, acct, cache, true)
+	return err
+}
+
+// maskString 脱敏字符串，按字符（rune）计算，避免截断多字节的中文名称：
+// 不超过 8 个字符时完全隐藏，16 个字符以下保留首尾各 2 个，更长的保留首尾各 4 个
 func maskString(s string) string {
-	if len(s) <= 8 {
+	runes := []rune(s)
+	keep := 4
+	switch {
+	case len(runes) <= 8:
 		return "****"
+	case len(runes) < 16:
+		keep = 2
 	}
-	return s[:4] + "****" + s[len(s)-4:]
+	return string(runes[:keep]) + "****" + string(runes[len(runes)-keep:])
 }
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/plugin-api"
+)
+
+// fakeMessageHandler 记录插件发出的 Gotify 通知
+type fakeMessageHandler struct {
+	mu   sync.Mutex
+	msgs []plugin.Message
+}
+
+func (h *fakeMessageHandler) SendMessage(msg plugin.Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.msgs = append(h.msgs, msg)
+	return nil
+}
+
+// testConfig 返回一份可以通过校验的最小配置
+func testConfig() *Config {
+	c := (&WeChatPlugin{}).DefaultConfig().(*Config)
+	c.AppID = "wx1234567890abcdef"
+	c.AppSecret = "0123456789abcdef0123456789abcdef"
+	c.TemplateID = "tmpl_abcdefghijklmnop"
+	c.OpenID = "o123456789012345678901234567"
+	return c
+}
+
+// mockWeChat 模拟微信接口：stable_token 默认每次签发新的 token，可由 token 覆盖；模板消息按 send 返回结果
+type mockWeChat struct {
+	tokenCalls   atomic.Int64
+	forcedTokens atomic.Int64
+	sendCalls    atomic.Int64
+	token        func(forced bool) AccessTokenResponse
+	send         func(call int64, token string) WechatAPIResponse
+}
+
+func (m *mockWeChat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cgi-bin/stable_token":
+		var req struct {
+			ForceRefresh bool `json:"force_refresh"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		n := m.tokenCalls.Add(1)
+		if req.ForceRefresh {
+			m.forcedTokens.Add(1)
+		}
+		resp := AccessTokenResponse{AccessToken: fmt.Sprintf("token-%d", n), ExpiresIn: 7200}
+		if m.token != nil {
+			resp = m.token(req.ForceRefresh)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case "/cgi-bin/message/template/send":
+		n := m.sendCalls.Add(1)
+		resp := WechatAPIResponse{Msgid: n}
+		if m.send != nil {
+			resp = m.send(n, r.URL.Query().Get("access_token"))
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTestPlugin 创建已按 c 配置的插件，微信接口指向 handler 模拟的服务器
+func newTestPlugin(t *testing.T, handler http.Handler, c *Config) *WeChatPlugin {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	base := wechatAPIBase
+	wechatAPIBase = srv.URL
+	t.Cleanup(func() { wechatAPIBase = base })
+
+	p := NewGotifyPluginInstance(plugin.UserContext{Name: "tester"}).(*WeChatPlugin)
+	p.SetMessageHandler(&fakeMessageHandler{})
+	if err := p.ValidateAndSetConfig(c); err != nil {
+		t.Fatalf("ValidateAndSetConfig: %v", err)
+	}
+	return p
+}
+
+// TestSendDuringConfigUpdate 发送与配置更新、reload 并发进行，需配合 go test -race 运行
+func TestSendDuringConfigUpdate(t *testing.T) {
+	p := newTestPlugin(t, &mockWeChat{}, testConfig())
+	if err := p.Enable(); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	defer p.Disable()
+
+	r := p.getAllRecipients()[0]
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := p.sendToWeChat(context.Background(), r, OutgoingMessage{Title: "title", Content: "content"}, nil); err != nil {
+				t.Errorf("send %d: %v", i, err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			c := testConfig()
+			c.MaxConcurrency = 1 + i%3
+			if err := p.ValidateAndSetConfig(c); err != nil {
+				t.Errorf("ValidateAndSetConfig %d: %v", i, err)
+				return
+			}
+			if _, err := p.reload(); err != nil {
+				t.Errorf("reload %d: %v", i, err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+// TestEndpointToggleWithoutRestart 启动时关闭的 /send、/test 在配置开启后应立即可用
+func TestEndpointToggleWithoutRestart(t *testing.T) {
+	c := testConfig()
+	c.EnableSendEndpoint = false
+	c.EnableTestEndpoint = false
+	p := newTestPlugin(t, &mockWeChat{}, c)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	p.RegisterWebhook("/plugin/1/custom/wechat/", engine.Group("/"))
+
+	status := func(method, path string) int {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(`{"title":"t","content":"c"}`)))
+		return w.Code
+	}
+	if got := status(http.MethodPost, "/send"); got != http.StatusNotFound {
+		t.Errorf("disabled /send returned %d, want 404", got)
+	}
+	if got := status(http.MethodGet, "/test"); got != http.StatusNotFound {
+		t.Errorf("disabled /test returned %d, want 404", got)
+	}
+
+	if err := p.ValidateAndSetConfig(testConfig()); err != nil {
+		t.Fatalf("ValidateAndSetConfig: %v", err)
+	}
+	// 插件未启用，开启的端点返回 503 而不是 404
+	if got := status(http.MethodPost, "/send"); got != http.StatusServiceUnavailable {
+		t.Errorf("enabled /send returned %d, want 503", got)
+	}
+	if got := status(http.MethodGet, "/test"); got != http.StatusServiceUnavailable {
+		t.Errorf("enabled /test returned %d, want 503", got)
+	}
+}
+
+func TestMaskString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "****"},
+		{"abc", "****"},
+		{"12345678", "****"},
+		{"张三", "****"},
+		{"运维值班手机号码", "****"},
+		{"123456789", "12****89"},
+		{"运维值班群机器人通知", "运维****通知"},
+		{"o12345678901234", "o1****34"},
+		{"o123456789012345678901234567", "o123****4567"},
+		{"微信推送运维值班群机器人备用通知", "微信推送****备用通知"},
+		{"wx1234567890abcdef", "wx12****cdef"},
+	}
+	for _, tt := range tests {
+		got := maskString(tt.in)
+		if got != tt.want {
+			t.Errorf("maskString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("maskString(%q) = %q is not valid UTF-8", tt.in, got)
+		}
+	}
+}
+
+// TestSendRefreshesRejectedToken 微信返回 42001 时应强制刷新一次 token 并用新 token 重发
+func TestSendRefreshesRejectedToken(t *testing.T) {
+	mock := &mockWeChat{}
+	mock.send = func(call int64, token string) WechatAPIResponse {
+		if call == 1 {
+			return WechatAPIResponse{Errcode: 42001, Errmsg: "access_token expired"}
+		}
+		if token == "token-1" {
+			return WechatAPIResponse{Errcode: 40001, Errmsg: "resent with the rejected token"}
+		}
+		return WechatAPIResponse{Msgid: 42}
+	}
+	p := newTestPlugin(t, mock, testConfig())
+
+	msgid, err := p.sendToWeChat(context.Background(), p.getAllRecipients()[0], OutgoingMessage{Title: "title", Content: "content"}, nil)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if msgid != 42 {
+		t.Errorf("msgid = %d, want 42", msgid)
+	}
+	if got := mock.forcedTokens.Load(); got != 1 {
+		t.Errorf("forced token refreshes = %d, want 1", got)
+	}
+	if got := mock.tokenCalls.Load(); got != 2 {
+		t.Errorf("token requests = %d, want 2 (initial + forced)", got)
+	}
+	if got := mock.sendCalls.Load(); got != 2 {
+		t.Errorf("send requests = %d, want 2", got)
+	}
+}
+
+// floorConfig 返回两个接收者的配置，其中 bob 只接收优先级不低于 5 的消息
+func floorConfig() *Config {
+	five := 5
+	c := testConfig()
+	c.OpenID = ""
+	c.Recipients = []Recipient{
+		{Name: "alice", OpenID: "o123456789012345678901234567"},
+		{Name: "bob", OpenID: "o765432109876543210987654321", MinPriority: &five},
+	}
+	return c
+}
+
+// TestSendToMultipleSkipsFloor 优先级低于 min_priority 的接收者被跳过、计入已过滤，并在结果中标记 filtered
+func TestSendToMultipleSkipsFloor(t *testing.T) {
+	mock := &mockWeChat{}
+	p := newTestPlugin(t, mock, floorConfig())
+
+	results := p.sendToMultiple(p.getAllRecipients(), OutgoingMessage{Title: "title", Content: "content", Priority: 1})
+	byName := make(map[string]sendResult)
+	for _, r := range results {
+		byName[r.Recipient] = r
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(results), results)
+	}
+	if r := byName["alice"]; !r.OK || r.Filtered {
+		t.Errorf("alice = %+v, want sent", r)
+	}
+	if r := byName["bob"]; r.OK || !r.Filtered {
+		t.Errorf("bob = %+v, want filtered", r)
+	}
+	if errs := results.errors(); len(errs) != 0 {
+		t.Errorf("filtered recipient counted as failure: %v", errs)
+	}
+	if got := mock.sendCalls.Load(); got != 1 {
+		t.Errorf("send requests = %d, want 1", got)
+	}
+	total, byRecipient := p.msgMgr.Filtered()
+	if total != 1 || byRecipient["bob"] != 1 {
+		t.Errorf("filtered = %d %v, want 1 for bob", total, byRecipient)
+	}
+
+	results = p.sendToMultiple(p.getAllRecipients(), OutgoingMessage{Title: "title", Content: "content", Priority: 1, BypassFloor: true})
+	if got := results.delivered(); got != 2 {
+		t.Errorf("delivered with BypassFloor = %d, want 2: %+v", got, results)
+	}
+	if total, _ := p.msgMgr.Filtered(); total != 1 {
+		t.Errorf("filtered after BypassFloor = %d, want 1", total)
+	}
+}
+
+// TestTargetedSendsIgnoreFloor /test 和按名称指定接收者的 /send 不受 min_priority 限制；
+// 未指定接收者时被过滤的接收者出现在 results 中，全部被过滤时不能返回成功
+func TestTargetedSendsIgnoreFloor(t *testing.T) {
+	mock := &mockWeChat{}
+	p := newTestPlugin(t, mock, floorConfig())
+	if err := p.Enable(); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	defer p.Disable()
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	p.RegisterWebhook("/plugin/1/custom/wechat/", engine.Group("/"))
+
+	type response struct {
+		Success bool         `json:"success"`
+		Results []sendResult `json:"results"`
+	}
+	do := func(method, path, body string) (int, response) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		engine.ServeHTTP(w, req)
+		var resp response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: invalid response %q", method, path, w.Body.String())
+		}
+		return w.Code, resp
+	}
+
+	if code, resp := do(http.MethodGet, "/test?recipient=bob", ""); code != http.StatusOK || len(resp.Results) != 1 || !resp.Results[0].OK {
+		t.Errorf("/test?recipient=bob = %d %+v, want one delivered result", code, resp)
+	}
+	if code, resp := do(http.MethodPost, "/send", `{"title":"t","content":"c","recipients":["bob"]}`); code != http.StatusOK || resp.Results[0].Filtered {
+		t.Errorf("/send to bob = %d %+v, want delivered", code, resp)
+	}
+
+	code, resp := do(http.MethodPost, "/send", `{"title":"t","content":"c"}`)
+	if code != http.StatusOK || !resp.Success || len(resp.Results) != 2 {
+		t.Fatalf("/send to all = %d %+v, want alice delivered and bob filtered", code, resp)
+	}
+	if !resp.Results[1].Filtered || resp.Results[1].Recipient != "bob" {
+		t.Errorf("bob result = %+v, want filtered", resp.Results[1])
+	}
+
+	c := floorConfig()
+	c.Recipients = c.Recipients[1:]
+	if err := p.ValidateAndSetConfig(c); err != nil {
+		t.Fatalf("ValidateAndSetConfig: %v", err)
+	}
+	if code, resp := do(http.MethodPost, "/send", `{"title":"t","content":"c"}`); code != http.StatusOK || resp.Success || len(resp.Results) != 1 {
+		t.Errorf("/send with every recipient filtered = %d %+v, want success false", code, resp)
+	}
+	if got := mock.sendCalls.Load(); got != 3 {
+		t.Errorf("send requests = %d, want 3", got)
+	}
+}
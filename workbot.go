@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// workBotTextMessage 企业微信群机器人文本消息
+type workBotTextMessage struct {
+	MsgType string             `json:"msgtype"`
+	Text    workBotTextContent `json:"text"`
+}
+
+type workBotTextContent struct {
+	Content string `json:"content"`
+}
+
+// workBotMarkdownMessage 企业微信群机器人 markdown 消息
+type workBotMarkdownMessage struct {
+	MsgType  string             `json:"msgtype"`
+	Markdown workBotTextContent `json:"markdown"`
+}
+
+// workBotNewsMessage 企业微信群机器人图文消息，用于转发带图片的消息
+type workBotNewsMessage struct {
+	MsgType string             `json:"msgtype"`
+	News    workBotNewsContent `json:"news"`
+}
+
+type workBotNewsContent struct {
+	Articles []workBotArticle `json:"articles"`
+}
+
+type workBotArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+	PicURL      string `json:"picurl"`
+}
+
+// 群机器人图文消息标题和描述的最大长度（UTF-8 字节）
+const (
+	workBotNewsTitleMaxBytes       = 128
+	workBotNewsDescriptionMaxBytes = 512
+)
+
+// workBotMarkdownMaxBytes 群机器人 markdown 内容的最大长度（UTF-8 字节）
+const workBotMarkdownMaxBytes = 4096
+
+// workBotMarkdownEscaper 转义会被 markdown 渲染器解析的字符
+var workBotMarkdownEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;",
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "#", `\#`,
+)
+
+// workBotLevelColors 各优先级级别在群机器人 markdown 中的颜色
+var workBotLevelColors = map[string]string{
+	priorityLow:    "info",
+	priorityMedium: "comment",
+	priorityHigh:   "warning",
+}
+
+// sendWorkBotMessage 向接收者的企业微信群机器人 webhook 发送一次消息：
+// 带图片时发送图文消息，点击跳转到接收者的跳转链接（未配置时打开图片），否则发送文本或 markdown 消息
+func (p *WeChatPlugin) sendWorkBotMessage(ctx context.Context, r Recipient, msg OutgoingMessage) error {
+	cfg := p.configSnapshot()
+	if cfg == nil {
+		return fmt.Errorf("plugin not configured")
+	}
+
+	msg = cfg.prepareText(msg)
+	var payload interface{} = workBotTextMessage{
+		MsgType: "text",
+		Text:    workBotTextContent{Content: msg.Title + "\n" + msg.Content},
+	}
+	if cfg.WorkBotMarkdown {
+		payload = workBotMarkdownMessage{
+			MsgType:  "markdown",
+			Markdown: workBotTextContent{Content: cfg.workBotMarkdown(msg)},
+		}
+	}
+	if msg.ImageURL != "" {
+		link := cfg.jumpURLFor(r)
+		if link == "" {
+			link = msg.ImageURL
+		}
+		payload = workBotNewsMessage{
+			MsgType: "news",
+			News: workBotNewsContent{Articles: []workBotArticle{{
+				Title:       truncateBytes(msg.Title, workBotNewsTitleMaxBytes),
+				Description: truncateBytes(msg.Content, workBotNewsDescriptionMaxBytes),
+				URL:         link,
+				PicURL:      msg.ImageURL,
+			}}},
+		}
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := p.postJSON(ctx, r.WebhookURL, jsonData)
+	if err != nil {
+		// webhook 地址中的 key 相当于密钥，不直接输出原始错误中的 URL
+		return &retryableError{fmt.Errorf("failed to send request: %w", redactURLError(err))}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed to read response: %w", err)}
+	}
+
+	var apiResp WechatAPIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		err = fmt.Errorf("failed to parse response (HTTP %d): %w", resp.StatusCode, err)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &retryableError{err}
+		}
+		return err
+	}
+
+	if apiResp.Errcode != 0 {
+		return newWorkBotError(apiResp.Errcode, apiResp.Errmsg)
+	}
+
+	p.logEvent(levelInfo, "message_sent", logFields{"recipient": maskString(r.WebhookURL)}, "Message sent successfully to work bot %s", maskString(r.WebhookURL))
+	return nil
+}
+
+// workBotMarkdown 将消息渲染为群机器人 markdown：加粗标题 + 彩色优先级标签 + 内容
+func (c *Config) workBotMarkdown(msg OutgoingMessage) string {
+	header := fmt.Sprintf("**%s** <font color=\"%s\">%s</font>\n",
+		workBotMarkdownEscaper.Replace(msg.Title), workBotLevelColors[priorityLevel(msg.Priority)], c.priorityLabel(msg.Priority))
+	return header + escapeMarkdownLimit(msg.Content, workBotMarkdownMaxBytes-len(header))
+}
+
+// truncateBytes 将文本截断到最多 maxBytes 个 UTF-8 字节（含省略号），不会截断在多字节字符中间
+func truncateBytes(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	limit := maxBytes - len(ellipsis)
+	n := 0
+	for i, r := range s {
+		size := utf8.RuneLen(r)
+		if i+size > limit {
+			break
+		}
+		n = i + size
+	}
+	return s[:n] + ellipsis
+}
+
+// escapeMarkdownLimit 转义 markdown 文本，结果超过 maxBytes 时按字符截断并追加省略号，
+// 不会截断在多字节字符或转义序列中间
+func escapeMarkdownLimit(s string, maxBytes int) string {
+	escaped := workBotMarkdownEscaper.Replace(s)
+	if len(escaped) <= maxBytes {
+		return escaped
+	}
+
+	limit := maxBytes - len(ellipsis)
+	var b strings.Builder
+	for _, r := range s {
+		part := workBotMarkdownEscaper.Replace(string(r))
+		if b.Len()+len(part) > limit {
+			break
+		}
+		b.WriteString(part)
+	}
+	if limit < 0 {
+		return ""
+	}
+	return b.String() + ellipsis
+}